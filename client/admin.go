@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+const endpointAdminPeers = "/admin/peers"
+const endpointAdminMining = "/admin/mining"
+const endpointAdminMiner = "/admin/miner"
+const endpointAdminMempoolFlush = "/admin/mempool/flush"
+
+const queryKeyBan = "ban"
+
+// The admin methods require a Client created by WithAdminToken.
+
+func (c *Client) AdminPeers(ctx context.Context) (AdminPeersRes, error) {
+	res := AdminPeersRes{}
+	err := c.get(ctx, endpointAdminPeers, nil, &res)
+
+	return res, err
+}
+
+// AdminAddPeer adds a Peer the node handshakes with on its next sync.
+func (c *Client) AdminAddPeer(ctx context.Context, req AdminPeerAddReq) (AdminPeersRes, error) {
+	res := AdminPeersRes{}
+	err := c.post(ctx, endpointAdminPeers, req, &res)
+
+	return res, err
+}
+
+// AdminRemovePeer removes the Peer at `ip`:`port` from the KnownPeers,
+// banning it too if `ban` is set.
+func (c *Client) AdminRemovePeer(
+	ctx context.Context, ip string, port uint64, ban bool) (AdminPeersRes, error) {
+	query := url.Values{}
+	query.Set(queryKeyIP, ip)
+	query.Set(queryKeyPort, strconv.FormatUint(port, 10))
+	query.Set(queryKeyBan, strconv.FormatBool(ban))
+
+	res := AdminPeersRes{}
+	err := c.delete(ctx, endpointAdminPeers, query, &res)
+
+	return res, err
+}
+
+func (c *Client) AdminMining(ctx context.Context) (AdminMiningRes, error) {
+	res := AdminMiningRes{}
+	err := c.get(ctx, endpointAdminMining, nil, &res)
+
+	return res, err
+}
+
+// AdminSetMining pauses or resumes the miner. Pausing abandons the block
+// being mined, its TXs stay pending.
+func (c *Client) AdminSetMining(ctx context.Context, enabled bool) (AdminMiningRes, error) {
+	res := AdminMiningRes{}
+	err := c.post(ctx, endpointAdminMining, AdminMiningReq{Enabled: enabled}, &res)
+
+	return res, err
+}
+
+// AdminSetMiner changes the account receiving the rewards of the blocks
+// mined from now on.
+func (c *Client) AdminSetMiner(ctx context.Context, req AdminMinerReq) (AdminMiningRes, error) {
+	res := AdminMiningRes{}
+	err := c.post(ctx, endpointAdminMiner, req, &res)
+
+	return res, err
+}
+
+// AdminFlushMempool drops every pending TX of the node.
+func (c *Client) AdminFlushMempool(ctx context.Context) (AdminMempoolFlushRes, error) {
+	res := AdminMempoolFlushRes{}
+	err := c.post(ctx, endpointAdminMempoolFlush, struct{}{}, &res)
+
+	return res, err
+}
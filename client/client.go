@@ -0,0 +1,252 @@
+// Package client is a Go SDK for the sb node HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const DefaultTimeout = 30 * time.Second
+
+const endpointBalancesList = "/balances/list"
+const endpointTxAdd = "/tx/add"
+const endpointTxSubmit = "/tx/submit"
+const endpointStatus = "/node/status"
+const endpointSync = "/node/sync"
+const endpointHeaders = "/node/headers"
+const endpointHandshake = "/node/handshake"
+const endpointAddPeer = "/node/peer"
+
+const queryKeyFromBlock = "fromBlock"
+const queryKeyLimit = "limit"
+const queryKeyIP = "ip"
+const queryKeyPort = "port"
+const queryKeyAccount = "account"
+const queryKeyChallenge = "challenge"
+const queryKeySig = "sig"
+const queryKeyTLS = "tls"
+
+// APIError is returned when the node answers with a non 2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected response status %d. %s", e.StatusCode, e.Message)
+}
+
+// MalformedResError is returned when the node response can't be decoded.
+type MalformedResError struct {
+	Err error
+}
+
+func (e *MalformedResError) Error() string {
+	return fmt.Sprintf("unable to unmarshal response body. %s", e.Err.Error())
+}
+
+func (e *MalformedResError) Unwrap() error {
+	return e.Err
+}
+
+// Client calls the HTTP API of the node reachable at its base URL,
+// e.g. http://localhost:8080.
+type Client struct {
+	baseUrl    string
+	httpClient *http.Client
+	adminToken string
+}
+
+// New creates a Client of the node at `baseUrl`. Without a `httpClient`,
+// requests time out after DefaultTimeout.
+func New(baseUrl string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return &Client{strings.TrimSuffix(baseUrl, "/"), httpClient, ""}
+}
+
+// WithAdminToken returns a copy of the Client authenticating its requests
+// with the bearer `token` required by the /admin/* endpoints.
+func (c *Client) WithAdminToken(token string) *Client {
+	adminClient := *c
+	adminClient.adminToken = token
+
+	return &adminClient
+}
+
+func (c *Client) Balances(ctx context.Context) (BalancesRes, error) {
+	res := BalancesRes{}
+	err := c.get(ctx, endpointBalancesList, nil, &res)
+
+	return res, err
+}
+
+// SendTx asks the node to sign the TX with the sender keystore account.
+func (c *Client) SendTx(ctx context.Context, req TxAddReq) (TxAddRes, error) {
+	res := TxAddRes{}
+	err := c.post(ctx, endpointTxAdd, req, &res)
+
+	return res, err
+}
+
+// SubmitSignedTx sends a TX signed client-side, the private key never
+// leaves the caller.
+func (c *Client) SubmitSignedTx(
+	ctx context.Context, tx database.SignedTx) (TxSubmitRes, error) {
+	res := TxSubmitRes{}
+	err := c.post(ctx, endpointTxSubmit, tx, &res)
+
+	return res, err
+}
+
+func (c *Client) Status(ctx context.Context) (StatusRes, error) {
+	res := StatusRes{}
+	err := c.get(ctx, endpointStatus, nil, &res)
+
+	return res, err
+}
+
+// BlocksAfter fetches one page of at most `limit` blocks following the
+// `fromBlock` cursor.
+func (c *Client) BlocksAfter(
+	ctx context.Context, fromBlock database.Hash, limit int) (SyncRes, error) {
+	res := SyncRes{}
+	err := c.get(ctx, endpointSync, pageQuery(fromBlock, limit), &res)
+
+	return res, err
+}
+
+// HeadersAfter fetches one page of at most `limit` block headers
+// following the `fromBlock` cursor.
+func (c *Client) HeadersAfter(
+	ctx context.Context, fromBlock database.Hash, limit int) (HeadersRes, error) {
+	res := HeadersRes{}
+	err := c.get(ctx, endpointHeaders, pageQuery(fromBlock, limit), &res)
+
+	return res, err
+}
+
+// Handshake asks the node to prove its identity by signing `challenge`
+// for the node joining from `ip`:`port`.
+func (c *Client) Handshake(
+	ctx context.Context, challenge string, ip string, port uint64) (HandshakeRes, error) {
+	query := url.Values{}
+	query.Set(queryKeyChallenge, challenge)
+	query.Set(queryKeyIP, ip)
+	query.Set(queryKeyPort, strconv.FormatUint(port, 10))
+
+	res := HandshakeRes{}
+	err := c.get(ctx, endpointHandshake, query, &res)
+
+	return res, err
+}
+
+// PeerAdd joins the KnownPeers of the node. A refusal is reported in the
+// AddPeerRes rather than as an error.
+func (c *Client) PeerAdd(ctx context.Context, req PeerAddReq) (AddPeerRes, error) {
+	query := url.Values{}
+	query.Set(queryKeyIP, req.IP)
+	query.Set(queryKeyPort, strconv.FormatUint(req.Port, 10))
+	query.Set(queryKeyAccount, req.Account.Hex())
+	query.Set(queryKeyChallenge, req.Challenge)
+	query.Set(queryKeySig, hex.EncodeToString(req.Sig))
+	query.Set(queryKeyTLS, strconv.FormatBool(req.TLS))
+
+	res := AddPeerRes{}
+	err := c.get(ctx, endpointAddPeer, query, &res)
+
+	return res, err
+}
+
+func pageQuery(fromBlock database.Hash, limit int) url.Values {
+	query := url.Values{}
+	query.Set(queryKeyFromBlock, fromBlock.Hex())
+	query.Set(queryKeyLimit, strconv.Itoa(limit))
+
+	return query
+}
+
+func (c *Client) get(
+	ctx context.Context, endpoint string, query url.Values, res interface{}) error {
+	return c.sendQuery(ctx, http.MethodGet, endpoint, query, res)
+}
+
+func (c *Client) delete(
+	ctx context.Context, endpoint string, query url.Values, res interface{}) error {
+	return c.sendQuery(ctx, http.MethodDelete, endpoint, query, res)
+}
+
+// sendQuery sends a `method` request without body, passing the `query`
+// in the URL.
+func (c *Client) sendQuery(
+	ctx context.Context, method string, endpoint string, query url.Values, res interface{}) error {
+	target := c.baseUrl + endpoint
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.do(req, res)
+}
+
+func (c *Client) post(
+	ctx context.Context, endpoint string, reqBody interface{}, res interface{}) error {
+	reqJson, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, c.baseUrl+endpoint, bytes.NewReader(reqJson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, res)
+}
+
+// do decodes the response body as it streams in, without buffering the
+// whole payload in memory first.
+func (c *Client) do(req *http.Request, res interface{}) error {
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+
+	httpRes, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode < 200 || httpRes.StatusCode > 299 {
+		errRes := ErrRes{}
+		_ = json.NewDecoder(io.LimitReader(httpRes.Body, 1<<16)).Decode(&errRes)
+
+		return &APIError{httpRes.StatusCode, errRes.Error}
+	}
+
+	err = json.NewDecoder(httpRes.Body).Decode(res)
+	if err != nil {
+		return &MalformedResError{err}
+	}
+
+	return nil
+}
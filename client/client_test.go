@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+func TestClient_Status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != endpointStatus {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte(`{"block_hash": "0000000000000000000000000000000000000000000000000000000000000001", "block_number": 7, "peers_known": {"127.0.0.1:8080": {"ip": "127.0.0.1", "port": 8080}}}`))
+	}))
+	defer server.Close()
+
+	status, err := New(server.URL+"/", nil).Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Number != 7 || status.Hash != (database.Hash{31: 1}) {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if status.KnownPeers["127.0.0.1:8080"].Port != 8080 {
+		t.Fatal("known peers should be decoded")
+	}
+}
+
+func TestClient_TypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case endpointTxAdd:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "insufficient balance"}`))
+		case endpointBalancesList:
+			w.Write([]byte(`{"balances": `))
+		case endpointStatus:
+			time.Sleep(time.Second)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, nil)
+
+	_, err := c.SendTx(context.Background(), TxAddReq{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "insufficient balance" {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+
+	_, err = c.Balances(context.Background())
+	var malformedResErr *MalformedResError
+	if !errors.As(err, &malformedResErr) {
+		t.Fatalf("expected a MalformedResError, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.Status(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request should be cancelled with the context, got %v", err)
+	}
+}
+
+func TestClient_PeerAdd(t *testing.T) {
+	account := common.HexToAddress("0x22ba1f80452e6220c7cc6ea2d1e3eeddac5f694a")
+	sig := []byte{1, 2, 3}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != endpointAddPeer ||
+			query.Get(queryKeyIP) != "127.0.0.1" ||
+			query.Get(queryKeyPort) != "8081" ||
+			common.HexToAddress(query.Get(queryKeyAccount)) != account ||
+			query.Get(queryKeySig) != hex.EncodeToString(sig) ||
+			query.Get(queryKeyTLS) != "true" {
+			w.Write([]byte(`{"success": false, "error": "unexpected query"}`))
+			return
+		}
+
+		w.Write([]byte(`{"success": true}`))
+	}))
+	defer server.Close()
+
+	res, err := New(server.URL, nil).PeerAdd(context.Background(), PeerAddReq{
+		IP:        "127.0.0.1",
+		Port:      8081,
+		Account:   account,
+		Challenge: "challenge",
+		Sig:       sig,
+		TLS:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Success {
+		t.Fatal(res.Error)
+	}
+}
+
+func TestClient_AdminTokenAndRemovePeer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodDelete || r.URL.Path != endpointAdminPeers || r.URL.Query().Get(queryKeyBan) != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`{"known": [], "banned": [{"ip": "127.0.0.1", "port": 8086, "reason": "banned"}]}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, nil)
+
+	_, err := c.AdminRemovePeer(context.Background(), "127.0.0.1", 8086, true)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("request without the admin token should be rejected, got %v", err)
+	}
+
+	res, err := c.WithAdminToken("secret").AdminRemovePeer(context.Background(), "127.0.0.1", 8086, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Banned) != 1 || res.Banned[0].Port != 8086 {
+		t.Fatalf("unexpected peers %+v", res)
+	}
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const endpointMiningWork = "/mining/work"
+const endpointMiningSubmit = "/mining/submit"
+
+const queryKeyMiner = "miner"
+
+// MiningWork fetches a block template of the pending TXs crediting the
+// block reward to `miner`, the node miner if empty.
+//
+// Without pending TXs to mine, the node answers an APIError with the 503
+// status.
+func (c *Client) MiningWork(ctx context.Context, miner common.Address) (MiningWorkRes, error) {
+	query := url.Values{}
+	if miner != (common.Address{}) {
+		query.Set(queryKeyMiner, miner.Hex())
+	}
+
+	res := MiningWorkRes{}
+	err := c.get(ctx, endpointMiningWork, query, &res)
+
+	return res, err
+}
+
+// SubmitMiningWork sends the nonce solving the MiningWork `req.ID`, the
+// node adds the mined block to its chain.
+func (c *Client) SubmitMiningWork(ctx context.Context, req MiningSubmitReq) (MiningSubmitRes, error) {
+	res := MiningSubmitRes{}
+	err := c.post(ctx, endpointMiningSubmit, req, &res)
+
+	return res, err
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+type ErrRes struct {
+	Error string `json:"error"`
+}
+
+type BalancesRes struct {
+	Hash     database.Hash           `json:"block_hash"`
+	Balances map[common.Address]uint `json:"balances"`
+}
+
+type TxAddReq struct {
+	From    string `json:"from"`
+	FromPwd string `json:"from_pwd"`
+	To      string `json:"to"`
+	Value   uint   `json:"value"`
+	Data    string `json:"data,omitempty"`
+}
+
+type TxAddRes struct {
+	Success bool          `json:"success"`
+	Hash    database.Hash `json:"hash"`
+}
+
+type TxSubmitRes struct {
+	Hash database.Hash `json:"hash"`
+}
+
+// Peer is a node as advertised in the KnownPeers of a status.
+type Peer struct {
+	IP          string         `json:"ip"`
+	Port        uint64         `json:"port"`
+	IsBootstrap bool           `json:"is_bootstrap"`
+	Account     common.Address `json:"account"`
+	TLS         bool           `json:"tls"`
+}
+
+type StatusRes struct {
+	Hash       database.Hash       `json:"block_hash"`
+	Number     uint64              `json:"block_number"`
+	KnownPeers map[string]Peer     `json:"peers_known"`
+	PendingTXs []database.SignedTx `json:"pending_txs"`
+}
+
+type SyncRes struct {
+	Blocks        []database.Block `json:"blocks"`
+	HasMore       bool             `json:"has_more"`
+	NextFromBlock database.Hash    `json:"next_from_block"`
+}
+
+type HeadersRes struct {
+	Headers []database.BlockHeaderFS `json:"headers"`
+	HasMore bool                     `json:"has_more"`
+}
+
+type HandshakeRes struct {
+	Challenge string         `json:"challenge"`
+	Account   common.Address `json:"account"`
+	Sig       []byte         `json:"signature"`
+}
+
+// PeerAddReq registers the joining node into the KnownPeers of a Peer,
+// answering the Peer handshake `Challenge` with its `Sig`.
+type PeerAddReq struct {
+	IP        string
+	Port      uint64
+	Account   common.Address
+	Challenge string
+	Sig       []byte
+	TLS       bool
+}
+
+type AddPeerRes struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// AdminPeer is a KnownPeer of the node, along with its sync state.
+type AdminPeer struct {
+	Peer
+	Connected bool `json:"connected"`
+	Score     int  `json:"score"`
+}
+
+type AdminBannedPeer struct {
+	IP      string         `json:"ip"`
+	Port    uint64         `json:"port"`
+	Account common.Address `json:"account"`
+	Reason  string         `json:"reason"`
+	Until   time.Time      `json:"until"`
+}
+
+type AdminPeersRes struct {
+	Known  []AdminPeer       `json:"known"`
+	Banned []AdminBannedPeer `json:"banned"`
+}
+
+// AdminPeerAddReq adds a Peer to the KnownPeers, lifting its ban if any.
+// The Peer `Account` is verified on the next handshake, any if omitted.
+type AdminPeerAddReq struct {
+	IP      string         `json:"ip"`
+	Port    uint64         `json:"port"`
+	Account common.Address `json:"account,omitempty"`
+	TLS     bool           `json:"tls,omitempty"`
+}
+
+type AdminMiningReq struct {
+	Enabled bool `json:"enabled"`
+}
+
+type AdminMinerReq struct {
+	Miner common.Address `json:"miner"`
+}
+
+type AdminMiningRes struct {
+	Enabled  bool           `json:"enabled"`
+	IsMining bool           `json:"is_mining"`
+	Miner    common.Address `json:"miner"`
+}
+
+type AdminMempoolFlushRes struct {
+	Flushed int `json:"flushed"`
+}
+
+// MiningWorkRes is a block template for an external miner to find the
+// nonce of. The block hash covers the TXs through the header TX root, so
+// they are handed out too.
+type MiningWorkRes struct {
+	ID     database.Hash       `json:"id"`
+	Parent database.Hash       `json:"parent"`
+	Number uint64              `json:"number"`
+	Time   uint64              `json:"time"`
+	Miner  common.Address      `json:"miner"`
+	TXs    []database.SignedTx `json:"payload"`
+	Target database.Hash       `json:"target"`
+}
+
+type MiningSubmitReq struct {
+	ID    database.Hash `json:"id"`
+	Nonce uint32        `json:"nonce"`
+}
+
+type MiningSubmitRes struct {
+	Hash   database.Hash `json:"block_hash"`
+	Number uint64        `json:"block_number"`
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/simone-trubian/blockchain-tutorial/client"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/node"
+	"github.com/spf13/cobra"
+)
+
+const envAdminToken = "SB_API_ADMIN_TOKEN"
+
+func adminCmd() *cobra.Command {
+	var adminCmd = &cobra.Command{
+		Use:   "admin",
+		Short: "Manages a running node through its admin API (peers, mining, mempool...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	adminCmd.PersistentFlags().String(
+		flagNode,
+		fmt.Sprintf("http://%s:%d", node.DefaultIP, node.DefaultHTTPort),
+		"URL of the node HTTP API")
+
+	adminCmd.PersistentFlags().String(
+		flagAdminToken,
+		"",
+		fmt.Sprintf("admin token configured on the node, defaults to the %s env variable", envAdminToken))
+
+	adminCmd.AddCommand(adminPeersCmd())
+	adminCmd.AddCommand(adminMiningCmd())
+	adminCmd.AddCommand(adminMinerCmd())
+	adminCmd.AddCommand(adminMempoolCmd())
+
+	return adminCmd
+}
+
+func adminPeersCmd() *cobra.Command {
+	var adminPeersCmd = &cobra.Command{
+		Use:   "peers",
+		Short: "Manages the node peers (list, add, remove).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	adminPeersCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the peers known and banned by the running node.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := getAdminClientFromCmd(cmd).AdminPeers(context.Background())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			printAdminPeers(res)
+		},
+	})
+
+	adminPeersCmd.AddCommand(&cobra.Command{
+		Use:   "add [account@]ip:port",
+		Short: "Adds a peer, prefixed with https:// if it serves TLS, lifting its ban if any.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			peer, err := node.ParseBootnode(args[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			res, err := getAdminClientFromCmd(cmd).AdminAddPeer(context.Background(), client.AdminPeerAddReq{
+				IP:      peer.IP,
+				Port:    peer.Port,
+				Account: peer.Account,
+				TLS:     peer.TLS,
+			})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			printAdminPeers(res)
+		},
+	})
+
+	var adminPeersRemoveCmd = &cobra.Command{
+		Use:   "remove ip:port",
+		Short: "Removes a peer from the known peers.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ip, portRaw, err := net.SplitHostPort(args[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			port, err := strconv.ParseUint(portRaw, 10, 16)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("invalid port '%s'", portRaw))
+				os.Exit(1)
+			}
+
+			ban, _ := cmd.Flags().GetBool(flagBan)
+
+			res, err := getAdminClientFromCmd(cmd).AdminRemovePeer(context.Background(), ip, port, ban)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			printAdminPeers(res)
+		},
+	}
+
+	adminPeersRemoveCmd.Flags().Bool(
+		flagBan,
+		false,
+		"bans the peer too, so it can't join again before the ban expires")
+
+	adminPeersCmd.AddCommand(adminPeersRemoveCmd)
+
+	return adminPeersCmd
+}
+
+func printAdminPeers(res client.AdminPeersRes) {
+	fmt.Println("Known peers:")
+	fmt.Println("__________________")
+	fmt.Println("")
+	for _, peer := range res.Known {
+		fmt.Printf(
+			"%s:%d (%s) bootstrap: %t connected: %t score: %d\n",
+			peer.IP,
+			peer.Port,
+			peer.Account.String(),
+			peer.IsBootstrap,
+			peer.Connected,
+			peer.Score)
+	}
+
+	fmt.Println("")
+
+	fmt.Println("Banned peers:")
+	fmt.Println("__________________")
+	fmt.Println("")
+	for _, bannedPeer := range res.Banned {
+		fmt.Printf(
+			"%s:%d (%s) until %s: %s\n",
+			bannedPeer.IP,
+			bannedPeer.Port,
+			bannedPeer.Account.String(),
+			bannedPeer.Until.Format(time.RFC3339),
+			bannedPeer.Reason)
+	}
+}
+
+func adminMiningCmd() *cobra.Command {
+	var adminMiningCmd = &cobra.Command{
+		Use:   "mining",
+		Short: "Pauses or resumes mining (status, start, stop).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	adminMiningCmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Reports whether the node mines and for which account.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := getAdminClientFromCmd(cmd).AdminMining(context.Background())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			printAdminMining(res)
+		},
+	})
+
+	for _, enabled := range []bool{true, false} {
+		enabled := enabled
+
+		use, short := "start", "Resumes mining the pending TXs."
+		if !enabled {
+			use, short = "stop", "Pauses mining, abandoning the block being mined."
+		}
+
+		adminMiningCmd.AddCommand(&cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				res, err := getAdminClientFromCmd(cmd).AdminSetMining(context.Background(), enabled)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+
+				printAdminMining(res)
+			},
+		})
+	}
+
+	return adminMiningCmd
+}
+
+func adminMinerCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "miner account",
+		Short: "Changes the account receiving the rewards of the next mined blocks.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := getAdminClientFromCmd(cmd).AdminSetMiner(
+				context.Background(), client.AdminMinerReq{Miner: database.NewAccount(args[0])})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			printAdminMining(res)
+		},
+	}
+}
+
+func printAdminMining(res client.AdminMiningRes) {
+	fmt.Printf(
+		"mining enabled: %t mining now: %t miner: %s\n",
+		res.Enabled,
+		res.IsMining,
+		res.Miner.String())
+}
+
+func adminMempoolCmd() *cobra.Command {
+	var adminMempoolCmd = &cobra.Command{
+		Use:   "mempool",
+		Short: "Manages the pending TXs (flush).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	adminMempoolCmd.AddCommand(&cobra.Command{
+		Use:   "flush",
+		Short: "Drops every pending TX of the node.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			res, err := getAdminClientFromCmd(cmd).AdminFlushMempool(context.Background())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Dropped %d pending TXs\n", res.Flushed)
+		},
+	})
+
+	return adminMempoolCmd
+}
+
+func getAdminClientFromCmd(cmd *cobra.Command) *client.Client {
+	nodeUrl, _ := cmd.Flags().GetString(flagNode)
+
+	token, _ := cmd.Flags().GetString(flagAdminToken)
+	if token == "" {
+		token = os.Getenv(envAdminToken)
+	}
+
+	return client.New(nodeUrl, nil).WithAdminToken(token)
+}
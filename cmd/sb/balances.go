@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
 	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -30,7 +32,21 @@ func balancesListCmd() *cobra.Command {
 		Short: "Lists all balances.",
 		Run: func(cmd *cobra.Command, args []string) {
 			dataDir, _ := cmd.Flags().GetString(flagDataDir)
-			state, err := database.NewStateFromDisk(dataDir)
+
+			genesis, err := database.LoadGenesis(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			// The blocks are only verified, not sealed
+			engine, err := consensus.New(genesis.Consensus, consensus.Options{})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			state, err := database.NewStateFromDisk(dataDir, engine, logger.Discard())
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/simone-trubian/blockchain-tutorial/config"
+	"github.com/spf13/cobra"
+)
+
+func configCmd() *cobra.Command {
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the node configuration (dump...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	configCmd.AddCommand(configDumpCmd())
+
+	return configCmd
+}
+
+func configDumpCmd() *cobra.Command {
+	var configDumpCmd = &cobra.Command{
+		Use:   "dump",
+		Short: "Prints the effective config merging the file, env and flags, secrets redacted.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := loadConfigFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			cfgYaml, err := cfg.Dump()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Print(string(cfgYaml))
+		},
+	}
+
+	addConfigFlags(configDumpCmd)
+
+	return configDumpCmd
+}
+
+// addConfigFlags registers the flags overriding the config file and env.
+func addConfigFlags(cmd *cobra.Command) {
+	defaults := config.Default()
+
+	cmd.Flags().String(
+		flagConfig,
+		"",
+		"path to the YAML config file, overridden by the SB_<SECTION>_<KEY> env variables and the flags")
+
+	cmd.Flags().String(
+		flagDataDir,
+		"",
+		"Absolute path to the node data dir where the DB will/is stored")
+
+	cmd.Flags().String(
+		flagIP,
+		defaults.Network.IP,
+		"exposed IP for communication with peers")
+
+	cmd.Flags().Uint64(
+		flagPort,
+		defaults.Network.Port,
+		"exposed HTTP port for communication with peers")
+
+	cmd.Flags().String(
+		flagMiner,
+		defaults.Mining.Miner,
+		"miner account of this node to receive block rewards")
+
+	cmd.Flags().Int(
+		flagMiningThreads,
+		defaults.Mining.Threads,
+		"goroutines mining a block, 0 to use all the CPU cores")
+
+	cmd.Flags().String(
+		flagBootstrapIp,
+		defaults.Network.BootstrapIP,
+		"default bootstrap server to interconnect peers, empty to disable")
+
+	cmd.Flags().Uint64(
+		flagBootstrapPort,
+		defaults.Network.BootstrapPort,
+		"default bootstrap server port to interconnect peers")
+
+	cmd.Flags().String(
+		flagBootstrapAcc,
+		defaults.Network.BootstrapAccount,
+		"default bootstrap server node account verified on the handshake, any if empty")
+
+	cmd.Flags().StringSlice(
+		flagBootnodes,
+		defaults.Network.Bootnodes,
+		"comma separated bootstrap peers as [account@]ip:port, replacing the default bootstrap server")
+
+	cmd.Flags().Duration(
+		flagPeerBanDuration,
+		defaults.Network.PeerBanDuration,
+		"how long misbehaving peers stay banned")
+
+	cmd.Flags().Bool(
+		flagTLS,
+		defaults.Network.TLS,
+		"serves HTTPS using the data dir tls/node.crt and tls/node.key")
+
+	cmd.Flags().Bool(
+		flagTLSMutual,
+		defaults.Network.TLSMutual,
+		"enables TLS and authenticates peers with certificates signed by the data dir tls/ca.crt")
+
+	cmd.Flags().String(
+		flagLogLevel,
+		defaults.Log.Level,
+		"minimum log level: trace, debug, info, warn, error or crit")
+
+	cmd.Flags().String(
+		flagLogFormat,
+		defaults.Log.Format,
+		"log output format: terminal or json")
+}
+
+// loadConfigFromCmd loads the config file and env, then applies the flags
+// explicitly set on the command line and validates the result.
+func loadConfigFromCmd(cmd *cobra.Command) (config.Config, error) {
+	path, _ := cmd.Flags().GetString(flagConfig)
+
+	cfg, err := config.Load(path, os.LookupEnv)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed(flagDataDir) {
+		cfg.Storage.DataDir, _ = flags.GetString(flagDataDir)
+	}
+	if flags.Changed(flagIP) {
+		cfg.Network.IP, _ = flags.GetString(flagIP)
+	}
+	if flags.Changed(flagPort) {
+		cfg.Network.Port, _ = flags.GetUint64(flagPort)
+	}
+	if flags.Changed(flagMiner) {
+		cfg.Mining.Miner, _ = flags.GetString(flagMiner)
+	}
+	if flags.Changed(flagMiningThreads) {
+		cfg.Mining.Threads, _ = flags.GetInt(flagMiningThreads)
+	}
+	if flags.Changed(flagBootstrapIp) {
+		cfg.Network.BootstrapIP, _ = flags.GetString(flagBootstrapIp)
+	}
+	if flags.Changed(flagBootstrapPort) {
+		cfg.Network.BootstrapPort, _ = flags.GetUint64(flagBootstrapPort)
+	}
+	if flags.Changed(flagBootstrapAcc) {
+		cfg.Network.BootstrapAccount, _ = flags.GetString(flagBootstrapAcc)
+	}
+	if flags.Changed(flagBootnodes) {
+		cfg.Network.Bootnodes, _ = flags.GetStringSlice(flagBootnodes)
+	}
+	if flags.Changed(flagPeerBanDuration) {
+		cfg.Network.PeerBanDuration, _ = flags.GetDuration(flagPeerBanDuration)
+	}
+	if flags.Changed(flagTLS) {
+		cfg.Network.TLS, _ = flags.GetBool(flagTLS)
+	}
+	if flags.Changed(flagTLSMutual) {
+		cfg.Network.TLSMutual, _ = flags.GetBool(flagTLSMutual)
+	}
+	if flags.Changed(flagLogLevel) {
+		cfg.Log.Level, _ = flags.GetString(flagLogLevel)
+	}
+	if flags.Changed(flagLogFormat) {
+		cfg.Log.Format, _ = flags.GetString(flagLogFormat)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
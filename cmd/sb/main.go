@@ -12,9 +12,20 @@ const flagDataDir = "datadir"
 const flagPort = "port"
 const flagIP = "ip"
 const flagMiner = "miner"
+const flagMiningThreads = "mining-threads"
 const flagBootstrapAcc = "bootstrap-account"
 const flagBootstrapIp = "bootstrap-ip"
 const flagBootstrapPort = "bootstrap-port"
+const flagBootnodes = "bootnodes"
+const flagPeerBanDuration = "peer-ban-duration"
+const flagTLS = "tls"
+const flagTLSMutual = "tls-mutual"
+const flagLogLevel = "log-level"
+const flagLogFormat = "log-format"
+const flagConfig = "config"
+const flagNode = "node"
+const flagAdminToken = "admin-token"
+const flagBan = "ban"
 
 func main() {
 	var sbCmd = &cobra.Command{
@@ -27,6 +38,10 @@ func main() {
 	sbCmd.AddCommand(runCmd())
 	sbCmd.AddCommand(balancesCmd())
 	sbCmd.AddCommand(walletCmd())
+	sbCmd.AddCommand(peersCmd())
+	sbCmd.AddCommand(configCmd())
+	sbCmd.AddCommand(adminCmd())
+	sbCmd.AddCommand(minerCmd())
 
 	err := sbCmd.Execute()
 	if err != nil {
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/simone-trubian/blockchain-tutorial/client"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+	"github.com/simone-trubian/blockchain-tutorial/node"
+	"github.com/spf13/cobra"
+)
+
+// minerPollInterval is how often the external miner asks for work when the
+// node has none, and checks whether the chain moved on while mining.
+const minerPollInterval = 5 * time.Second
+
+func minerCmd() *cobra.Command {
+	var minerCmd = &cobra.Command{
+		Use:   "miner",
+		Short: "Mines the pending TXs of a running node on this machine.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			nodeUrl, _ := cmd.Flags().GetString(flagNode)
+			minerRaw, _ := cmd.Flags().GetString(flagMiner)
+			threads, _ := cmd.Flags().GetInt(flagMiningThreads)
+			logLevel, _ := cmd.Flags().GetString(flagLogLevel)
+			logFormat, _ := cmd.Flags().GetString(flagLogFormat)
+
+			miner := common.Address{}
+			if minerRaw != "" {
+				if !common.IsHexAddress(minerRaw) {
+					fmt.Fprintln(os.Stderr, fmt.Errorf("invalid miner '%s'", minerRaw))
+					os.Exit(1)
+				}
+
+				miner = database.NewAccount(minerRaw)
+			}
+
+			minerLogger, err := logger.New(os.Stderr, logLevel, logFormat)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			minerLogger = logger.ForSubsystem(minerLogger, logger.SubsystemMiner)
+
+			ctx, stop := signal.NotifyContext(
+				context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			minerLogger.Info("Mining for node", "node", nodeUrl, "threads", threads)
+
+			runExternalMiner(ctx, client.New(nodeUrl, nil), miner, threads, minerLogger)
+		},
+	}
+
+	minerCmd.Flags().String(
+		flagNode,
+		fmt.Sprintf("http://%s:%d", node.DefaultIP, node.DefaultHTTPort),
+		"URL of the node HTTP API")
+
+	minerCmd.Flags().String(
+		flagMiner,
+		"",
+		"account to receive the block rewards, the node miner if empty")
+
+	minerCmd.Flags().Int(
+		flagMiningThreads,
+		0,
+		"goroutines mining a block, 0 to use all the CPU cores")
+
+	minerCmd.Flags().String(
+		flagLogLevel,
+		logger.DefaultLevel,
+		"minimum log level: trace, debug, info, warn, error or crit")
+
+	minerCmd.Flags().String(
+		flagLogFormat,
+		logger.DefaultFormat,
+		"log output format: terminal or json")
+
+	return minerCmd
+}
+
+// runExternalMiner mines the work handed out by the node, one block after
+// another, until the `ctx` is cancelled.
+func runExternalMiner(
+	ctx context.Context,
+	c *client.Client,
+	miner common.Address,
+	threads int,
+	minerLogger log.Logger) {
+	attempts := metrics.NewCounterForced()
+
+	for ctx.Err() == nil {
+		work, err := c.MiningWork(ctx, miner)
+
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable {
+			minerLogger.Debug("No mining work", "reason", apiErr.Message)
+			waitMinerPoll(ctx)
+			continue
+		}
+		if err != nil {
+			minerLogger.Warn("Unable to fetch mining work", "err", err)
+			waitMinerPoll(ctx)
+			continue
+		}
+
+		err = mineWork(ctx, c, work, threads, attempts, minerLogger)
+		if err != nil && ctx.Err() == nil {
+			minerLogger.Warn("Mining work failed", "id", work.ID.Hex(), "err", err)
+		}
+	}
+}
+
+// mineWork finds the nonce of the `work` and submits it, abandoning the
+// work once the node chain moves past its parent.
+func mineWork(
+	ctx context.Context,
+	c *client.Client,
+	work client.MiningWorkRes,
+	threads int,
+	attempts metrics.Counter,
+	minerLogger log.Logger) error {
+	workCtx, abandonWork := context.WithCancel(ctx)
+	defer abandonWork()
+
+	go func() {
+		ticker := time.NewTicker(minerPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				status, err := c.Status(workCtx)
+				if err == nil && status.Hash != work.Parent {
+					minerLogger.Info("Node chain moved on, abandoning mining work", "number", work.Number)
+					abandonWork()
+					return
+				}
+
+			case <-workCtx.Done():
+				return
+			}
+		}
+	}()
+
+	block, err := node.Mine(workCtx, node.NewPendingBlockFromWork(work), threads, attempts, minerLogger)
+	if err != nil {
+		if workCtx.Err() != nil {
+			return nil
+		}
+
+		return err
+	}
+
+	res, err := c.SubmitMiningWork(ctx, client.MiningSubmitReq{ID: work.ID, Nonce: block.Header.Nonce})
+	if err != nil {
+		return err
+	}
+
+	minerLogger.Info("Node added the mined block", "number", res.Number, "hash", res.Hash.Hex())
+
+	return nil
+}
+
+func waitMinerPoll(ctx context.Context) {
+	select {
+	case <-time.After(minerPollInterval):
+	case <-ctx.Done():
+	}
+}
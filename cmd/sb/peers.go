@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/simone-trubian/blockchain-tutorial/node"
+	"github.com/spf13/cobra"
+)
+
+func peersCmd() *cobra.Command {
+	var peersCmd = &cobra.Command{
+		Use:   "peers",
+		Short: "Interact with peers (list...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	peersCmd.AddCommand(peersListCmd())
+
+	return peersCmd
+}
+
+func peersListCmd() *cobra.Command {
+	var peersListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the peers known and banned by the node.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			knownPeers, err := node.LoadKnownPeers(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			bannedPeers, err := node.LoadBannedPeers(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Println("Known peers:")
+			fmt.Println("__________________")
+			fmt.Println("")
+			for tcpAddress, peer := range knownPeers {
+				fmt.Printf(
+					"%s (%s) bootstrap: %t\n",
+					tcpAddress,
+					peer.Account.String(),
+					peer.IsBootstrap)
+			}
+
+			fmt.Println("")
+
+			fmt.Println("Banned peers:")
+			fmt.Println("__________________")
+			fmt.Println("")
+			for tcpAddress, bannedPeer := range bannedPeers {
+				if time.Now().After(bannedPeer.Until) {
+					continue
+				}
+
+				fmt.Printf(
+					"%s (%s) until %s: %s\n",
+					tcpAddress,
+					bannedPeer.Account.String(),
+					bannedPeer.Until.Format(time.RFC3339),
+					bannedPeer.Reason)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(peersListCmd)
+
+	return peersListCmd
+}
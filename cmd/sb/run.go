@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
 	"github.com/simone-trubian/blockchain-tutorial/node"
 	"github.com/spf13/cobra"
 )
@@ -15,52 +17,42 @@ func runCmd() *cobra.Command {
 		Use:   "run",
 		Short: "Launches the SB node and its HTTP API.",
 		Run: func(cmd *cobra.Command, args []string) {
-			miner, _ := cmd.Flags().GetString(flagMiner)
-			ip, _ := cmd.Flags().GetString(flagIP)
-			port, _ := cmd.Flags().GetUint64(flagPort)
-			bootstrapIp, _ := cmd.Flags().GetString(flagBootstrapIp)
-			bootstrapPort, _ := cmd.Flags().GetUint64(flagBootstrapPort)
-			bootstrapAcc, _ := cmd.Flags().GetString(flagBootstrapAcc)
+			cfg, err := loadConfigFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			nodeCfg, err := cfg.NodeConfig()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
 
-			fmt.Println("Launching SB node and its HTTP API...")
+			nodeLogger, err := logger.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			nodeLogger.Info("Launching SB node and its HTTP API")
 
-			bootstrap := node.NewPeerNode(
-				bootstrapIp,
-				bootstrapPort,
-				true,
-				database.NewAccount(bootstrapAcc),
-				false,
-			)
+			n := node.New(nodeCfg, nodeLogger)
 
-			n := node.New(
-				getDataDirFromCmd(cmd),
-				ip,
-				port,
-				database.NewAccount((miner)),
-				bootstrap)
-			err := n.Run(context.Background())
+			// Stop gracefully on Ctrl+C or when the service manager asks to
+			ctx, stop := signal.NotifyContext(
+				context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			err = n.Run(ctx)
 			if err != nil {
-				fmt.Println(err)
+				nodeLogger.Error("Node stopped", "err", err)
 				os.Exit(1)
 			}
 		},
 	}
 
-	addDefaultRequiredFlags(runCmd)
-	runCmd.Flags().String(
-		flagIP,
-		node.DefaultIP,
-		"exposed IP for communication with peers")
-
-	runCmd.Flags().Uint64(
-		flagPort,
-		node.DefaultHTTPort,
-		"exposed HTTP port for communication with peers")
-
-	runCmd.Flags().String(
-		flagMiner,
-		node.DefaultMiner,
-		"miner account of this node to receive block rewards")
+	addConfigFlags(runCmd)
 
 	return runCmd
 }
@@ -0,0 +1,521 @@
+// Package config loads the settings of an SB node from a YAML file,
+// overridden by SB_<SECTION>_<KEY> environment variables.
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+	"github.com/simone-trubian/blockchain-tutorial/node"
+	"gopkg.in/yaml.v2"
+)
+
+const EnvPrefix = "SB"
+
+const maxPort = 65535
+
+// minAdminTokenLength keeps the admin token from being guessed.
+const minAdminTokenLength = 16
+
+type Config struct {
+	Storage StorageConfig `yaml:"storage"`
+	Network NetworkConfig `yaml:"network"`
+	Mining  MiningConfig  `yaml:"mining"`
+	Sync    SyncConfig    `yaml:"sync"`
+	API     APIConfig     `yaml:"api"`
+	Log     LogConfig     `yaml:"log"`
+
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+}
+
+type StorageConfig struct {
+	DataDir string `yaml:"datadir"`
+}
+
+type NetworkConfig struct {
+	IP               string        `yaml:"ip"`
+	Port             uint64        `yaml:"port"`
+	BootstrapIP      string        `yaml:"bootstrap_ip"`
+	BootstrapPort    uint64        `yaml:"bootstrap_port"`
+	BootstrapAccount string        `yaml:"bootstrap_account"`
+	Bootnodes        []string      `yaml:"bootnodes"`
+	PeerBanDuration  time.Duration `yaml:"peer_ban_duration"`
+	AcceptPeers      bool          `yaml:"accept_peers"`
+	TLS              bool          `yaml:"tls"`
+	TLSMutual        bool          `yaml:"tls_mutual"`
+}
+
+type MiningConfig struct {
+	Miner    string        `yaml:"miner"`
+	Interval time.Duration `yaml:"interval"`
+	// Threads mining a block, all the CPU cores if 0
+	Threads int `yaml:"threads"`
+}
+
+type SyncConfig struct {
+	Interval             time.Duration `yaml:"interval"`
+	ReadyMaxBlocksBehind uint64        `yaml:"ready_max_blocks_behind"`
+}
+
+type APIConfig struct {
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	AdminToken      string        `yaml:"admin_token"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	MaxBodyBytes    int64         `yaml:"max_body_bytes"`
+	// RateLimit caps the requests of each client IP per route, unless the
+	// route has its own limit in RouteRateLimits
+	RateLimit       RateLimitConfig            `yaml:"rate_limit"`
+	RouteRateLimits map[string]RateLimitConfig `yaml:"route_rate_limits"`
+	CORS            CORSConfig                 `yaml:"cors"`
+}
+
+// CORSConfig lets browser pages from `allowed_origins` call the public
+// endpoints, disabled without origins.
+type CORSConfig struct {
+	AllowedOrigins []string      `yaml:"allowed_origins"`
+	AllowedMethods []string      `yaml:"allowed_methods"`
+	AllowedHeaders []string      `yaml:"allowed_headers"`
+	MaxAge         time.Duration `yaml:"max_age"`
+}
+
+// RateLimitConfig is a token bucket of `burst` requests refilled with `rps`
+// requests per second, unlimited if `rps` is 0.
+type RateLimitConfig struct {
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+}
+
+func (c RateLimitConfig) rateLimit() node.RateLimit {
+	return node.RateLimit{RPS: c.RPS, Burst: c.Burst}
+}
+
+// WebhookConfig POSTs the committed `events` relating to the `addresses`
+// to `url`, signed with `secret`. A `direction` of in or out only keeps the
+// events crediting or debiting the `addresses`.
+type WebhookConfig struct {
+	ID        string   `yaml:"id"`
+	URL       string   `yaml:"url"`
+	Secret    string   `yaml:"secret"`
+	Events    []string `yaml:"events"`
+	Addresses []string `yaml:"addresses"`
+	Direction string   `yaml:"direction"`
+}
+
+func (c WebhookConfig) webhook() node.Webhook {
+	addresses := make([]common.Address, 0, len(c.Addresses))
+	for _, address := range c.Addresses {
+		addresses = append(addresses, database.NewAccount(address))
+	}
+
+	return node.Webhook{
+		ID:        c.ID,
+		URL:       c.URL,
+		Secret:    c.Secret,
+		Events:    c.Events,
+		Addresses: addresses,
+		Direction: c.Direction,
+	}
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+func Default() Config {
+	routeRateLimits := make(map[string]RateLimitConfig)
+	for route, limit := range node.DefaultRouteRateLimits() {
+		routeRateLimits[route] = RateLimitConfig{RPS: limit.RPS, Burst: limit.Burst}
+	}
+
+	defaultCORS := node.DefaultCORSConfig()
+
+	return Config{
+		Network: NetworkConfig{
+			IP:              node.DefaultIP,
+			Port:            node.DefaultHTTPort,
+			BootstrapIP:     node.DefaultBootstrapIp,
+			BootstrapPort:   node.DefaultBootstrapPort,
+			Bootnodes:       []string{},
+			PeerBanDuration: node.DefaultPeerBanDuration,
+			AcceptPeers:     true,
+		},
+		Mining: MiningConfig{
+			Miner:    node.DefaultMiner,
+			Interval: node.DefaultMiningInterval,
+		},
+		Sync: SyncConfig{
+			Interval:             node.DefaultSyncInterval,
+			ReadyMaxBlocksBehind: node.DefaultReadyMaxBlocksBehind,
+		},
+		API: APIConfig{
+			ShutdownTimeout: node.DefaultShutdownTimeout,
+			ReadTimeout:     node.DefaultReadTimeout,
+			WriteTimeout:    node.DefaultWriteTimeout,
+			MaxBodyBytes:    node.DefaultMaxBodyBytes,
+			RateLimit: RateLimitConfig{
+				RPS:   node.DefaultRateLimit.RPS,
+				Burst: node.DefaultRateLimit.Burst,
+			},
+			RouteRateLimits: routeRateLimits,
+			CORS: CORSConfig{
+				AllowedOrigins: defaultCORS.AllowedOrigins,
+				AllowedMethods: defaultCORS.AllowedMethods,
+				AllowedHeaders: defaultCORS.AllowedHeaders,
+				MaxAge:         defaultCORS.MaxAge,
+			},
+		},
+		Log: LogConfig{
+			Level:  logger.DefaultLevel,
+			Format: logger.DefaultFormat,
+		},
+		Webhooks: []WebhookConfig{},
+	}
+}
+
+// Load reads the YAML file at `path`, if not empty, on top of the defaults
+// and applies the environment overrides found by `lookupEnv`.
+//
+// Unknown keys are rejected so typos don't silently fall back to defaults.
+func Load(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		content, err := ioutil.ReadFile(fs.ExpandPath(path))
+		if err != nil {
+			return Config{}, err
+		}
+
+		// Strict decoding refuses the keys already set in a map, the
+		// default route rate limits are merged after
+		cfg.API.RouteRateLimits = make(map[string]RateLimitConfig)
+
+		err = yaml.UnmarshalStrict(content, &cfg)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid config file '%s'. %s", path, err.Error())
+		}
+
+		for route, limit := range Default().API.RouteRateLimits {
+			if _, isConfigured := cfg.API.RouteRateLimits[route]; !isConfigured {
+				cfg.API.RouteRateLimits[route] = limit
+			}
+		}
+	}
+
+	err := applyEnv(reflect.ValueOf(&cfg).Elem(), EnvPrefix, lookupEnv)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv walks the `v` struct fields by their YAML key, overriding the
+// ones having a matching environment variable.
+func applyEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		key := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		name := strings.ToUpper(prefix + "_" + key)
+
+		if field.Kind() == reflect.Struct {
+			err := applyEnv(field, name, lookupEnv)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, isSet := lookupEnv(name)
+		if !isSet {
+			continue
+		}
+
+		err := setFromString(field, raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s'. %s", name, raw, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func setFromString(field reflect.Value, raw string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(value)
+	case reflect.Uint64:
+		value, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(value)
+	case reflect.Int, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(value)
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(value)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+
+		values := make([]string, 0)
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// Validate reports every invalid value at once.
+func (c Config) Validate() error {
+	problems := make([]string, 0)
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Storage.DataDir == "" {
+		addProblem("storage.datadir is required")
+	}
+
+	if c.Network.IP == "" {
+		addProblem("network.ip is required")
+	}
+	if c.Network.Port == 0 || c.Network.Port > maxPort {
+		addProblem("network.port %d must be between 1 and %d", c.Network.Port, maxPort)
+	}
+	if c.Network.BootstrapIP != "" && (c.Network.BootstrapPort == 0 || c.Network.BootstrapPort > maxPort) {
+		addProblem("network.bootstrap_port %d must be between 1 and %d", c.Network.BootstrapPort, maxPort)
+	}
+	if c.Network.BootstrapAccount != "" && !common.IsHexAddress(c.Network.BootstrapAccount) {
+		addProblem("network.bootstrap_account '%s' is not an account", c.Network.BootstrapAccount)
+	}
+	for _, bootnode := range c.Network.Bootnodes {
+		_, err := node.ParseBootnode(bootnode)
+		if err != nil {
+			addProblem("network.bootnodes: %s", err.Error())
+		}
+	}
+	if c.Network.PeerBanDuration < 0 {
+		addProblem("network.peer_ban_duration can't be negative")
+	}
+
+	if !common.IsHexAddress(c.Mining.Miner) {
+		addProblem("mining.miner '%s' is not an account", c.Mining.Miner)
+	}
+	if c.Mining.Interval <= 0 {
+		addProblem("mining.interval must be positive")
+	}
+	if c.Mining.Threads < 0 {
+		addProblem("mining.threads can't be negative")
+	}
+
+	if c.Sync.Interval <= 0 {
+		addProblem("sync.interval must be positive")
+	}
+
+	if c.API.ShutdownTimeout <= 0 {
+		addProblem("api.shutdown_timeout must be positive")
+	}
+	if c.API.AdminToken != "" && len(c.API.AdminToken) < minAdminTokenLength {
+		addProblem("api.admin_token must be at least %d characters", minAdminTokenLength)
+	}
+	if c.API.ReadTimeout <= 0 || c.API.WriteTimeout <= 0 {
+		addProblem("api.read_timeout and api.write_timeout must be positive")
+	}
+	if c.API.MaxBodyBytes <= 0 {
+		addProblem("api.max_body_bytes must be positive")
+	}
+	validateRateLimit(c.API.RateLimit, "api.rate_limit", addProblem)
+	for route, limit := range c.API.RouteRateLimits {
+		if !strings.HasPrefix(route, "/") {
+			addProblem("api.route_rate_limits: route '%s' must start with /", route)
+		}
+		validateRateLimit(limit, fmt.Sprintf("api.route_rate_limits[%s]", route), addProblem)
+	}
+	for _, origin := range c.API.CORS.AllowedOrigins {
+		isURL := strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://")
+		if origin != "*" && (!isURL || strings.Count(origin, "*") > 1) {
+			addProblem("api.cors.allowed_origins: '%s' must be * or a http(s) origin with at most one *", origin)
+		}
+	}
+	if len(c.API.CORS.AllowedOrigins) > 0 && len(c.API.CORS.AllowedMethods) == 0 {
+		addProblem("api.cors.allowed_methods can't be empty when origins are allowed")
+	}
+	if c.API.CORS.MaxAge < 0 {
+		addProblem("api.cors.max_age can't be negative")
+	}
+
+	webhookIDs := make(map[string]bool)
+	for i, webhook := range c.Webhooks {
+		for _, address := range webhook.Addresses {
+			if !common.IsHexAddress(address) {
+				addProblem("webhooks[%d].addresses: '%s' is not an account", i, address)
+			}
+		}
+		if webhookIDs[webhook.ID] {
+			addProblem("webhooks[%d]: id '%s' is already used", i, webhook.ID)
+		}
+		webhookIDs[webhook.ID] = true
+
+		err := webhook.webhook().Validate()
+		if err != nil {
+			addProblem("webhooks[%d]: %s", i, err.Error())
+		}
+	}
+
+	_, err := logger.New(io.Discard, c.Log.Level, c.Log.Format)
+	if err != nil {
+		addProblem("log: %s", err.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+func validateRateLimit(
+	limit RateLimitConfig, key string, addProblem func(format string, args ...interface{})) {
+	if limit.RPS < 0 {
+		addProblem("%s.rps can't be negative", key)
+	}
+	if limit.RPS > 0 && limit.Burst < 1 {
+		addProblem("%s.burst must be at least 1", key)
+	}
+}
+
+// NodeConfig converts the validated config into the node settings.
+func (c Config) NodeConfig() (node.Config, error) {
+	cfg := node.DefaultConfig(fs.ExpandPath(c.Storage.DataDir))
+	cfg.IP = c.Network.IP
+	cfg.Port = c.Network.Port
+	cfg.Miner = database.NewAccount(c.Mining.Miner)
+	cfg.PeerBanDuration = c.Network.PeerBanDuration
+	cfg.AcceptPeers = c.Network.AcceptPeers
+	cfg.TLS = node.TLSConfig{
+		Enabled: c.Network.TLS || c.Network.TLSMutual,
+		Mutual:  c.Network.TLSMutual,
+	}
+	cfg.MiningInterval = c.Mining.Interval
+	cfg.MiningThreads = c.Mining.Threads
+	cfg.SyncInterval = c.Sync.Interval
+	cfg.ReadyMaxBlocksBehind = c.Sync.ReadyMaxBlocksBehind
+	cfg.ShutdownTimeout = c.API.ShutdownTimeout
+	cfg.AdminToken = c.API.AdminToken
+	cfg.ReadTimeout = c.API.ReadTimeout
+	cfg.WriteTimeout = c.API.WriteTimeout
+	cfg.MaxBodyBytes = c.API.MaxBodyBytes
+	cfg.RateLimit = c.API.RateLimit.rateLimit()
+	cfg.RouteRateLimits = make(map[string]node.RateLimit)
+	for route, limit := range c.API.RouteRateLimits {
+		cfg.RouteRateLimits[route] = limit.rateLimit()
+	}
+	cfg.CORS = node.CORSConfig{
+		AllowedOrigins: c.API.CORS.AllowedOrigins,
+		AllowedMethods: c.API.CORS.AllowedMethods,
+		AllowedHeaders: c.API.CORS.AllowedHeaders,
+		MaxAge:         c.API.CORS.MaxAge,
+	}
+	for _, webhook := range c.Webhooks {
+		cfg.Webhooks = append(cfg.Webhooks, webhook.webhook())
+	}
+
+	// The default bootstrap server is replaced by the bootnodes, unless
+	// another bootstrap server is explicitly configured
+	useBootstrap := len(c.Network.Bootnodes) == 0 ||
+		c.Network.BootstrapIP != node.DefaultBootstrapIp
+
+	if c.Network.BootstrapIP != "" && useBootstrap {
+		cfg.Bootstraps = append(cfg.Bootstraps, node.NewPeerNode(
+			c.Network.BootstrapIP,
+			c.Network.BootstrapPort,
+			true,
+			database.NewAccount(c.Network.BootstrapAccount),
+			false,
+		))
+	}
+
+	for _, bootnode := range c.Network.Bootnodes {
+		bootstrap, err := node.ParseBootnode(bootnode)
+		if err != nil {
+			return node.Config{}, err
+		}
+
+		cfg.Bootstraps = append(cfg.Bootstraps, bootstrap)
+	}
+
+	return cfg, nil
+}
+
+// RedactedSecret replaces the secrets set in the dumped config.
+const RedactedSecret = "<redacted>"
+
+// Dump renders the config as YAML, as read back by Load, with the admin
+// token and the webhook secrets replaced by RedactedSecret.
+func (c Config) Dump() ([]byte, error) {
+	return yaml.Marshal(c.redacted())
+}
+
+func (c Config) redacted() Config {
+	c.API.AdminToken = redactSecret(c.API.AdminToken)
+
+	webhooks := make([]WebhookConfig, 0, len(c.Webhooks))
+	for _, webhook := range c.Webhooks {
+		webhook.Secret = redactSecret(webhook.Secret)
+		webhooks = append(webhooks, webhook)
+	}
+	c.Webhooks = webhooks
+
+	return c
+}
+
+// redactSecret keeps an unset secret empty, showing it is unset.
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return RedactedSecret
+}
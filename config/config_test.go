@@ -0,0 +1,225 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simone-trubian/blockchain-tutorial/node"
+)
+
+func TestLoad_FileThenEnvOverrides(t *testing.T) {
+	path := writeTestConfigFile(t, `
+storage:
+  datadir: /tmp/sb
+network:
+  port: 8081
+  bootnodes: ["10.0.0.1:8080"]
+mining:
+  interval: 20s
+api:
+  route_rate_limits:
+    /tx/submit: {rps: 2, burst: 4}
+    /tx/add: {rps: 1, burst: 1}
+webhooks:
+  - id: funds
+    url: https://backoffice.example.com/sb
+    secret: change-me
+    events: [balances]
+    addresses: ["0x22ba1f80452e6220c7cc6ea2d1e3eeddac5f694a"]
+    direction: in
+`)
+
+	env := map[string]string{
+		"SB_API_RATE_LIMIT_RPS":       "2.5",
+		"SB_API_CORS_ALLOWED_ORIGINS": "https://wallet.example.com",
+		"SB_NETWORK_PORT":             "9090",
+		"SB_NETWORK_TLS":              "true",
+		"SB_SYNC_INTERVAL":            "1m",
+		"SB_NETWORK_BOOTNODES":        "10.0.0.2:8080, 10.0.0.3:8080",
+	}
+
+	cfg, err := Load(path, testLookupEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Storage.DataDir != "/tmp/sb" || cfg.Mining.Interval != 20*time.Second {
+		t.Fatalf("file values should be loaded, got %+v", cfg)
+	}
+
+	if cfg.Network.Port != 9090 || !cfg.Network.TLS || cfg.Sync.Interval != time.Minute {
+		t.Fatalf("env should override the file, got %+v", cfg)
+	}
+
+	if len(cfg.Network.Bootnodes) != 2 || cfg.Network.Bootnodes[1] != "10.0.0.3:8080" {
+		t.Fatalf("env bootnodes should be comma separated, got %v", cfg.Network.Bootnodes)
+	}
+
+	if len(cfg.API.CORS.AllowedOrigins) != 1 || len(cfg.API.CORS.AllowedMethods) != 2 {
+		t.Fatalf("CORS origins should be loaded along the default methods, got %+v", cfg.API.CORS)
+	}
+
+	if cfg.API.RateLimit.RPS != 2.5 || cfg.API.RouteRateLimits["/tx/submit"].Burst != 4 {
+		t.Fatalf("rate limits should be loaded, got %+v", cfg.API)
+	}
+
+	if cfg.API.RouteRateLimits["/tx/add"].RPS != 1 {
+		t.Fatalf("route rate limits should override the defaults, got %v", cfg.API.RouteRateLimits)
+	}
+
+	if len(cfg.Webhooks) != 1 || cfg.Webhooks[0].Direction != "in" {
+		t.Fatalf("webhooks should be loaded, got %+v", cfg.Webhooks)
+	}
+
+	if cfg.Log.Level != Default().Log.Level {
+		t.Fatalf("unset values should keep their default, got %+v", cfg.Log)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad_RejectsUnknownKeysAndInvalidEnv(t *testing.T) {
+	_, err := Load(writeTestConfigFile(t, "mining:\n  intervl: 1s\n"), testLookupEnv(nil))
+	if err == nil || !strings.Contains(err.Error(), "intervl") {
+		t.Fatalf("unknown key should be rejected, got %v", err)
+	}
+
+	_, err = Load("", testLookupEnv(map[string]string{"SB_NETWORK_PORT": "http"}))
+	if err == nil || !strings.Contains(err.Error(), "SB_NETWORK_PORT") {
+		t.Fatalf("invalid env value should be rejected, got %v", err)
+	}
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.Network.Port = 70000
+	cfg.Network.Bootnodes = []string{"nope"}
+	cfg.Mining.Miner = "simone"
+	cfg.Sync.Interval = 0
+	cfg.Log.Format = "xml"
+	cfg.API.AdminToken = "secret"
+	cfg.API.RouteRateLimits["tx/add"] = RateLimitConfig{RPS: 1}
+	cfg.API.CORS.AllowedOrigins = []string{"wallet.example.com"}
+	cfg.Webhooks = []WebhookConfig{
+		{ID: "funds", URL: "http://localhost:9000", Addresses: []string{"tanya"}, Direction: "in"},
+		{ID: "funds", URL: "http://localhost:9000"},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config should be rejected")
+	}
+
+	for _, key := range []string{
+		"storage.datadir", "network.port", "network.bootnodes", "mining.miner", "sync.interval", "api.admin_token", "api.route_rate_limits[tx/add].burst", "must start with /", "api.cors.allowed_origins", "webhooks[0].addresses", "webhooks[1]: id 'funds'", "log",
+	} {
+		if !strings.Contains(err.Error(), key) {
+			t.Fatalf("'%s' problem should be reported, got %s", key, err)
+		}
+	}
+}
+
+func TestDump_RoundTrips(t *testing.T) {
+	cfg := Default()
+	cfg.Storage.DataDir = "/tmp/sb"
+	cfg.Mining.Interval = 3 * time.Second
+	cfg.API.RouteRateLimits = map[string]RateLimitConfig{}
+
+	cfgYaml, err := cfg.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(writeTestConfigFile(t, string(cfgYaml)), testLookupEnv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, hasDefault := loaded.API.RouteRateLimits["/tx/add"]; !hasDefault {
+		t.Fatalf("default route rate limits should be kept, got %v", loaded.API.RouteRateLimits)
+	}
+
+	if loaded.Mining.Interval != cfg.Mining.Interval || loaded.Storage.DataDir != cfg.Storage.DataDir {
+		t.Fatalf("dumped config should load back, got %+v", loaded)
+	}
+}
+
+func TestDump_RedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.API.AdminToken = "0123456789abcdef"
+	cfg.Webhooks = []WebhookConfig{
+		{ID: "funds", URL: "http://localhost:9000", Secret: "webhook-secret"},
+		{ID: "blocks", URL: "http://localhost:9001"},
+	}
+
+	cfgYaml, err := cfg.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{cfg.API.AdminToken, cfg.Webhooks[0].Secret} {
+		if strings.Contains(string(cfgYaml), secret) {
+			t.Fatalf("secret '%s' should be redacted, got\n%s", secret, cfgYaml)
+		}
+	}
+
+	loaded, err := Load(writeTestConfigFile(t, string(cfgYaml)), testLookupEnv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.API.AdminToken != RedactedSecret || loaded.Webhooks[0].Secret != RedactedSecret || loaded.Webhooks[1].Secret != "" {
+		t.Fatalf("only the set secrets should be redacted, got %+v %+v", loaded.API, loaded.Webhooks)
+	}
+
+	if cfg.Webhooks[0].Secret != "webhook-secret" {
+		t.Fatal("dumping should not redact the config itself")
+	}
+}
+
+func TestNodeConfig_BootnodesReplaceDefaultBootstrap(t *testing.T) {
+	cfg := Default()
+	cfg.Storage.DataDir = "/tmp/sb"
+
+	nodeCfg, err := cfg.NodeConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeCfg.Bootstraps) != 1 || nodeCfg.Bootstraps[0].IP != node.DefaultBootstrapIp {
+		t.Fatalf("default bootstrap server should be used, got %v", nodeCfg.Bootstraps)
+	}
+
+	cfg.Network.Bootnodes = []string{"10.0.0.1:8080"}
+
+	nodeCfg, err = cfg.NodeConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeCfg.Bootstraps) != 1 || nodeCfg.Bootstraps[0].IP != "10.0.0.1" {
+		t.Fatalf("bootnodes should replace the default bootstrap server, got %v", nodeCfg.Bootstraps)
+	}
+}
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "sb.yaml")
+
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func testLookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, isSet := env[name]
+		return value, isSet
+	}
+}
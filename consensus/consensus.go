@@ -0,0 +1,78 @@
+// Package consensus implements the engines deciding who may seal the
+// blocks of the chain, and how.
+package consensus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+)
+
+// The engines selected by the genesis consensus.
+const EnginePoW = "pow"
+const EnginePoA = "poa"
+const EngineDev = "dev"
+
+// ErrNotInTurn is returned by Prepare when the node may not seal the next
+// block, it has to wait for another node to seal it.
+var ErrNotInTurn = errors.New("not in turn to seal the block")
+
+// Consensus seals the blocks of the node and verifies the blocks of the
+// chain.
+type Consensus interface {
+	// Prepare sets the consensus fields of the `header` of the next block,
+	// failing with ErrNotInTurn if the node may not seal it.
+	Prepare(header *database.BlockHeader) error
+
+	// Seal makes the `block` valid for the chain until the `ctx` is done.
+	Seal(ctx context.Context, block database.Block) (database.Block, error)
+
+	// VerifyHeader checks the `header` was sealed following the engine
+	// rules, `sealHash` being the hash of its block without the seal
+	// signature.
+	VerifyHeader(header database.BlockHeader, sealHash database.Hash) error
+}
+
+// Options are the node settings of the engines.
+type Options struct {
+	// Threads mining a PoW block, all the CPU cores if not positive
+	Threads int
+	// Attempts counts the PoW block hashes computed
+	Attempts metrics.Counter
+	// SignerKey signs the PoA blocks, the node only verifies them without it
+	SignerKey *ecdsa.PrivateKey
+	Logger    log.Logger
+}
+
+// New creates the engine selected by the genesis `cfg`, PoW if none.
+func New(cfg database.ConsensusConfig, opts Options) (Consensus, error) {
+	if opts.Attempts == nil {
+		opts.Attempts = metrics.NewCounterForced()
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = logger.Discard()
+	}
+
+	switch cfg.Engine {
+	case "", EnginePoW:
+		return NewPoW(opts.Threads, opts.Attempts, opts.Logger), nil
+	case EnginePoA:
+		return NewPoA(cfg.Signers, opts.SignerKey, opts.Logger)
+	case EngineDev:
+		return NewDev(opts.Logger), nil
+	}
+
+	return nil, fmt.Errorf(
+		"unknown consensus engine '%s', expected '%s', '%s' or '%s'",
+		cfg.Engine,
+		EnginePoW,
+		EnginePoA,
+		EngineDev)
+}
@@ -0,0 +1,37 @@
+package consensus
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+func TestNew(t *testing.T) {
+	signers := []common.Address{database.NewAccount("0x22ba1f80452e6220c7cc6ea2d1e3eeddac5f694a")}
+
+	cases := []struct {
+		cfg     database.ConsensusConfig
+		isValid bool
+		engine  interface{}
+	}{
+		{database.ConsensusConfig{}, true, &PoW{}},
+		{database.ConsensusConfig{Engine: EnginePoW}, true, &PoW{}},
+		{database.ConsensusConfig{Engine: EnginePoA, Signers: signers}, true, &PoA{}},
+		{database.ConsensusConfig{Engine: EnginePoA}, false, nil},
+		{database.ConsensusConfig{Engine: EngineDev}, true, &Dev{}},
+		{database.ConsensusConfig{Engine: "pos"}, false, nil},
+	}
+
+	for _, c := range cases {
+		engine, err := New(c.cfg, Options{})
+		if (err == nil) != c.isValid {
+			t.Fatalf("engine '%s' valid should be %t, got %v", c.cfg.Engine, c.isValid, err)
+		}
+
+		if c.isValid && reflect.TypeOf(engine) != reflect.TypeOf(c.engine) {
+			t.Fatalf("engine '%s' should be a %T, got %T", c.cfg.Engine, c.engine, engine)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package consensus
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+// Dev seals the blocks instantly without any proof, any block is valid.
+// It is meant for local development chains only.
+type Dev struct {
+	logger log.Logger
+}
+
+func NewDev(logger log.Logger) *Dev {
+	return &Dev{logger}
+}
+
+func (d *Dev) Prepare(header *database.BlockHeader) error {
+	return nil
+}
+
+func (d *Dev) Seal(ctx context.Context, block database.Block) (database.Block, error) {
+	hash, err := block.Hash()
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	d.logger.Info("Sealed new block", "number", block.Header.Number, "hash", hash.Hex())
+
+	return block, nil
+}
+
+func (d *Dev) VerifyHeader(header database.BlockHeader, sealHash database.Hash) error {
+	return nil
+}
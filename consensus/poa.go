@@ -0,0 +1,121 @@
+package consensus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+// PoA lets a fixed set of signers seal the blocks in round-robin order:
+// the block N is signed by the signer N modulo the count of signers. The
+// chain halts while the signer in turn is offline.
+type PoA struct {
+	signers []common.Address
+	key     *ecdsa.PrivateKey
+	account common.Address
+	logger  log.Logger
+}
+
+// NewPoA creates a PoA engine of the `signers` sealing the blocks with the
+// `key` of its signer account, if any.
+func NewPoA(signers []common.Address, key *ecdsa.PrivateKey, logger log.Logger) (*PoA, error) {
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("the PoA consensus requires at least one signer")
+	}
+
+	isSigner := make(map[common.Address]bool)
+	for _, signer := range signers {
+		if isSigner[signer] {
+			return nil, fmt.Errorf("PoA signer '%s' is listed twice", signer.String())
+		}
+		isSigner[signer] = true
+	}
+
+	account := common.Address{}
+	if key != nil {
+		account = crypto.PubkeyToAddress(key.PublicKey)
+	}
+
+	return &PoA{signers, key, account, logger}, nil
+}
+
+// InTurnSigner is the signer of the block `number`.
+func (p *PoA) InTurnSigner(number uint64) common.Address {
+	return p.signers[number%uint64(len(p.signers))]
+}
+
+// Prepare fails with ErrNotInTurn unless the node is the signer of the
+// `header` block.
+func (p *PoA) Prepare(header *database.BlockHeader) error {
+	signer := p.InTurnSigner(header.Number)
+	if p.key == nil || signer != p.account {
+		return fmt.Errorf("%w, block '%d' is signed by '%s'", ErrNotInTurn, header.Number, signer.String())
+	}
+
+	header.Nonce = 0
+	header.Signature = nil
+
+	return nil
+}
+
+// Seal signs the `block` with the signer key.
+func (p *PoA) Seal(ctx context.Context, block database.Block) (database.Block, error) {
+	err := p.Prepare(&block.Header)
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	sealHash, err := block.SealHash()
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	sig, err := wallet.Sign(sealHash[:], p.key)
+	if err != nil {
+		return database.Block{}, fmt.Errorf("couldn't sign block. %s", err.Error())
+	}
+
+	block.Header.Signature = sig
+
+	hash, _ := block.Hash()
+
+	p.logger.Info(
+		"Signed new block",
+		"number", block.Header.Number,
+		"hash", hash.Hex(),
+		"parent", block.Header.Parent.Hex(),
+		"signer", p.account.String())
+
+	return block, nil
+}
+
+// VerifyHeader checks the block was signed by the signer in turn.
+func (p *PoA) VerifyHeader(header database.BlockHeader, sealHash database.Hash) error {
+	if len(header.Signature) == 0 {
+		return fmt.Errorf("PoA block '%d' is not signed", header.Number)
+	}
+
+	pubKey, err := wallet.Verify(sealHash[:], header.Signature)
+	if err != nil {
+		return err
+	}
+
+	signer := crypto.PubkeyToAddress(*pubKey)
+	inTurnSigner := p.InTurnSigner(header.Number)
+
+	if signer != inTurnSigner {
+		return fmt.Errorf(
+			"PoA block '%d' was signed by '%s' instead of '%s'",
+			header.Number,
+			signer.String(),
+			inTurnSigner.String())
+	}
+
+	return nil
+}
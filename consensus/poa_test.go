@@ -0,0 +1,153 @@
+package consensus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+func TestPoA_SealsInTurn(t *testing.T) {
+	keys, signers := generateSigners(t, 2)
+
+	poa, err := NewPoA(signers, keys[1], logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if poa.InTurnSigner(0) != signers[0] || poa.InTurnSigner(3) != signers[1] {
+		t.Fatal("signers should seal the blocks in round-robin order")
+	}
+
+	block := newTestBlock(t, keys[0], 0)
+	if err := poa.Prepare(&block.Header); !errors.Is(err, ErrNotInTurn) {
+		t.Fatalf("signer should wait for its turn, got %v", err)
+	}
+
+	if _, err := poa.Seal(context.Background(), block); !errors.Is(err, ErrNotInTurn) {
+		t.Fatalf("signer should only seal in turn, got %v", err)
+	}
+
+	block = newTestBlock(t, keys[0], 1)
+	if err := poa.Prepare(&block.Header); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := poa.Seal(context.Background(), block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealHash, err := sealed.SealHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := poa.VerifyHeader(sealed.Header, sealHash); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := NewPoA(signers, nil, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifier.VerifyHeader(sealed.Header, sealHash); err != nil {
+		t.Fatalf("nodes without a signer key should verify the blocks, got %v", err)
+	}
+
+	if err := verifier.Prepare(&block.Header); !errors.Is(err, ErrNotInTurn) {
+		t.Fatalf("nodes without a signer key should never seal, got %v", err)
+	}
+}
+
+func TestPoA_VerifyHeader(t *testing.T) {
+	keys, signers := generateSigners(t, 2)
+
+	poa, err := NewPoA(signers, keys[0], logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := poa.Seal(context.Background(), newTestBlock(t, keys[0], 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := sealed
+	unsigned.Header.Signature = nil
+	unsignedHash, _ := unsigned.SealHash()
+
+	if err := poa.VerifyHeader(unsigned.Header, unsignedHash); err == nil {
+		t.Fatal("unsigned block should be invalid")
+	}
+
+	// The signature covers the TXs payload through the TX root
+	tampered := sealed
+	tampered.Header.TxRoot = database.Hash{}
+	tamperedHash, _ := tampered.SealHash()
+
+	if err := poa.VerifyHeader(tampered.Header, tamperedHash); err == nil {
+		t.Fatal("block with tampered TXs should be invalid")
+	}
+
+	// Block 3 is signed by the second signer
+	outOfTurn := sealed
+	outOfTurn.Header.Number = 3
+	outOfTurn.Header.Signature = nil
+	outOfTurnHash, _ := outOfTurn.SealHash()
+	outOfTurn.Header.Signature, err = wallet.Sign(outOfTurnHash[:], keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := poa.VerifyHeader(outOfTurn.Header, outOfTurnHash); err == nil {
+		t.Fatal("block signed out of turn should be invalid")
+	}
+}
+
+func TestNewPoA_ValidatesSigners(t *testing.T) {
+	_, signers := generateSigners(t, 1)
+
+	if _, err := NewPoA([]common.Address{}, nil, logger.Discard()); err == nil {
+		t.Fatal("PoA without signers should be refused")
+	}
+
+	if _, err := NewPoA(append(signers, signers[0]), nil, logger.Discard()); err == nil {
+		t.Fatal("PoA with a duplicated signer should be refused")
+	}
+}
+
+func generateSigners(t *testing.T, count int) ([]*ecdsa.PrivateKey, []common.Address) {
+	keys := make([]*ecdsa.PrivateKey, count)
+	signers := make([]common.Address, count)
+
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys[i] = key
+		signers[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+
+	return keys, signers
+}
+
+func newTestBlock(t *testing.T, senderKey *ecdsa.PrivateKey, number uint64) database.Block {
+	sender := crypto.PubkeyToAddress(senderKey.PublicKey)
+
+	tx, err := wallet.SignTx(database.NewTx(sender, sender, 1, ""), senderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return database.NewBlock(database.Hash{}, number, 0, 1, sender, []database.SignedTx{tx})
+}
@@ -0,0 +1,256 @@
+package consensus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+// nonceSpace is the count of the uint32 nonces.
+const nonceSpace = 1 << 32
+
+// minerReportBatch is how many attempts a mining thread makes between two
+// updates of the attempts counters.
+const minerReportBatch = 1000
+
+// minerReportInterval is how often the hash rate is logged while mining.
+const minerReportInterval = 10 * time.Second
+
+// PoW seals a block by searching the nonce making its hash valid.
+type PoW struct {
+	threads  int
+	attempts metrics.Counter
+	logger   log.Logger
+}
+
+// NewPoW creates a PoW engine mining with `threads` goroutines, all the CPU
+// cores if not positive, counting every hash computed into `attempts`.
+func NewPoW(threads int, attempts metrics.Counter, logger log.Logger) *PoW {
+	if threads < 1 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+
+	return &PoW{threads, attempts, logger}
+}
+
+func IsBlockHashValid(hash database.Hash) bool {
+	return fmt.Sprintf("%x", hash[0]) == "0" &&
+		fmt.Sprintf("%x", hash[1]) == "0" &&
+		fmt.Sprintf("%x", hash[2]) == "0" &&
+		fmt.Sprintf("%x", hash[3]) != "0"
+}
+
+// BlockHashTarget is the largest hash IsBlockHashValid accepts, for the
+// external miners to compare their hashes with. The 4th byte of a valid
+// hash must not be zero either.
+func BlockHashTarget() database.Hash {
+	target := database.Hash{}
+	for i := 3; i < len(target); i++ {
+		target[i] = 0xff
+	}
+
+	return target
+}
+
+// Prepare lets any node mine the next block.
+func (p *PoW) Prepare(header *database.BlockHeader) error {
+	return nil
+}
+
+// miningResult is the outcome of a mining thread, without a block if the
+// thread was cancelled or ran out of nonces.
+type miningResult struct {
+	block   database.Block
+	isMined bool
+	err     error
+}
+
+// Seal searches the nonce of the `block`.
+//
+// The nonce space is split between the threads from a random first nonce:
+// thread i tries the nonces i, i+threads, i+2*threads... after it, so no
+// nonce is tried twice. The first thread finding a valid nonce stops the
+// others.
+func (p *PoW) Seal(ctx context.Context, block database.Block) (database.Block, error) {
+	firstNonce, err := randomNonce()
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	// Cancelled by the first thread mining the block to stop the others
+	miningCtx, stopMining := context.WithCancel(ctx)
+	defer stopMining()
+
+	start := time.Now()
+	var totalAttempts uint64
+	countAttempts := func(count uint64) {
+		atomic.AddUint64(&totalAttempts, count)
+		p.attempts.Inc(int64(count))
+	}
+
+	results := make(chan miningResult, p.threads)
+	var miningThreads sync.WaitGroup
+
+	for thread := 0; thread < p.threads; thread++ {
+		miningThreads.Add(1)
+		go func(thread int) {
+			defer miningThreads.Done()
+			results <- mineNonces(miningCtx, block, firstNonce, uint64(thread), uint64(p.threads), countAttempts)
+		}(thread)
+	}
+
+	go func() {
+		miningThreads.Wait()
+		close(results)
+	}()
+
+	p.logger.Debug("Mining pending TXs", "txs", len(block.TXs), "threads", p.threads)
+
+	report := time.NewTicker(minerReportInterval)
+	defer report.Stop()
+
+	for {
+		select {
+		case res, isOpen := <-results:
+			if !isOpen {
+				if ctx.Err() != nil {
+					p.logger.Info("Mining cancelled", "number", block.Header.Number, "attempts", atomic.LoadUint64(&totalAttempts))
+
+					return database.Block{}, fmt.Errorf("mining cancelled. %s", ctx.Err())
+				}
+
+				return database.Block{}, fmt.Errorf(
+					"couldn't mine block %d, every nonce was tried", block.Header.Number)
+			}
+
+			if res.err != nil {
+				return database.Block{}, fmt.Errorf("couldn't mine block. %s", res.err.Error())
+			}
+
+			if !res.isMined {
+				continue
+			}
+
+			stopMining()
+			miningThreads.Wait()
+
+			blockAttempts := atomic.LoadUint64(&totalAttempts)
+			hash, _ := res.block.Hash()
+
+			p.logger.Info(
+				"Mined new block",
+				"number", res.block.Header.Number,
+				"hash", hash.Hex(),
+				"nonce", res.block.Header.Nonce,
+				"parent", res.block.Header.Parent.Hex(),
+				"miner", res.block.Header.Miner.String(),
+				"attempts", blockAttempts,
+				"hashrate", formatHashRate(blockAttempts, time.Since(start)),
+				"elapsed", time.Since(start))
+
+			return res.block, nil
+
+		case <-report.C:
+			p.logger.Info(
+				"Mining",
+				"number", block.Header.Number,
+				"threads", p.threads,
+				"attempts", atomic.LoadUint64(&totalAttempts),
+				"hashrate", formatHashRate(atomic.LoadUint64(&totalAttempts), time.Since(start)))
+		}
+	}
+}
+
+// VerifyHeader checks the block hash satisfies the PoW. PoW blocks are not
+// signed, so `sealHash` is the block hash.
+func (p *PoW) VerifyHeader(header database.BlockHeader, sealHash database.Hash) error {
+	if len(header.Signature) != 0 {
+		return fmt.Errorf("PoW block '%d' must not be signed", header.Number)
+	}
+
+	if !IsBlockHashValid(sealHash) {
+		return fmt.Errorf("invalid block hash %x", sealHash)
+	}
+
+	return nil
+}
+
+// mineNonces tries the nonces `firstNonce`+`offset`, then every `step`
+// nonces, until one makes the `block` hash valid, the `ctx` is done or the
+// nonce space is exhausted.
+func mineNonces(
+	ctx context.Context,
+	block database.Block,
+	firstNonce uint32,
+	offset uint64,
+	step uint64,
+	countAttempts func(count uint64)) miningResult {
+	uncounted := uint64(0)
+	defer func() { countAttempts(uncounted) }()
+
+	for i := offset; i < nonceSpace; i += step {
+		select {
+		case <-ctx.Done():
+			return miningResult{}
+		default:
+		}
+
+		// Wraps around the nonce space past the largest nonce
+		block.Header.Nonce = firstNonce + uint32(i)
+		hash, err := block.Hash()
+		if err != nil {
+			return miningResult{err: err}
+		}
+
+		uncounted++
+		if uncounted == minerReportBatch {
+			countAttempts(uncounted)
+			uncounted = 0
+		}
+
+		if IsBlockHashValid(hash) {
+			return miningResult{block: block, isMined: true}
+		}
+	}
+
+	return miningResult{}
+}
+
+func randomNonce() (uint32, error) {
+	nonce := make([]byte, 4)
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't generate the first nonce. %s", err.Error())
+	}
+
+	return binary.BigEndian.Uint32(nonce), nil
+}
+
+// formatHashRate renders the hashes per second of `attempts` made during
+// `elapsed`, e.g. 1.25 MH/s.
+func formatHashRate(attempts uint64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "0.00 H/s"
+	}
+
+	rate := float64(attempts) / elapsed.Seconds()
+
+	for _, unit := range []string{"H/s", "kH/s", "MH/s"} {
+		if rate < 1000 {
+			return fmt.Sprintf("%.2f %s", rate, unit)
+		}
+		rate /= 1000
+	}
+
+	return fmt.Sprintf("%.2f GH/s", rate)
+}
@@ -0,0 +1,66 @@
+package consensus
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+func TestValidBlockHash(t *testing.T) {
+	hexHash := "000000fa04f8160395c387277f8b2f14837603383d33809a4db586086168edfa"
+	var hash = database.Hash{}
+
+	hex.Decode(hash[:], []byte(hexHash))
+
+	isValid := IsBlockHashValid(hash)
+	if !isValid {
+		t.Fatalf(
+			"hash '%s' starting with 6 zeroes is suppose to be valid", hexHash)
+	}
+}
+
+func TestInvalidBlockHash(t *testing.T) {
+	hexHash := "000001fa04f8160395c387277f8b2f14837603383d33809a4db586086168edfa"
+	var hash = database.Hash{}
+
+	hex.Decode(hash[:], []byte(hexHash))
+
+	isValid := IsBlockHashValid(hash)
+	if isValid {
+		t.Fatal("hash is not suppose to be valid")
+	}
+}
+
+func TestPoW_VerifyHeader(t *testing.T) {
+	validHash := database.Hash{3: 1}
+	pow := NewPoW(1, nil, nil)
+
+	if err := pow.VerifyHeader(database.BlockHeader{}, validHash); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pow.VerifyHeader(database.BlockHeader{}, database.Hash{0: 1}); err == nil {
+		t.Fatal("hash not satisfying the PoW should be invalid")
+	}
+
+	if err := pow.VerifyHeader(database.BlockHeader{Signature: []byte{1}}, validHash); err == nil {
+		t.Fatal("signed PoW block should be invalid")
+	}
+}
+
+func TestFormatHashRate(t *testing.T) {
+	cases := map[string]string{
+		formatHashRate(500, time.Second):        "500.00 H/s",
+		formatHashRate(2500000, 2*time.Second):  "1.25 MH/s",
+		formatHashRate(3000000000, time.Second): "3.00 GH/s",
+		formatHashRate(1, 0):                    "0.00 H/s",
+	}
+
+	for hashRate, expected := range cases {
+		if hashRate != expected {
+			t.Fatalf("expected %s, got %s", expected, hashRate)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -44,6 +45,19 @@ type BlockHeader struct {
 	Nonce  uint32         `json:"nonce"`
 	Time   uint64         `json:"time"`
 	Miner  common.Address `json:"miner"`
+	// TxRoot commits the header to the TXs payload, so the block hash and
+	// seal can be checked from the header alone
+	TxRoot Hash `json:"tx_root"`
+	// Signature seals the blocks of the consensus engines signing them
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// HeaderVerifier checks the blocks were sealed following the rules of the
+// chain consensus engine.
+type HeaderVerifier interface {
+	// VerifyHeader checks the `header` seal, `sealHash` being the hash of
+	// its block without the seal signature.
+	VerifyHeader(header BlockHeader, sealHash Hash) error
 }
 
 type BlockFS struct {
@@ -51,6 +65,11 @@ type BlockFS struct {
 	Value Block `json:"block"`
 }
 
+type BlockHeaderFS struct {
+	Key   Hash        `json:"hash"`
+	Value BlockHeader `json:"header"`
+}
+
 func NewBlock(
 	parent Hash,
 	number uint64,
@@ -58,21 +77,161 @@ func NewBlock(
 	time uint64,
 	miner common.Address,
 	txs []SignedTx) Block {
-	return Block{BlockHeader{parent, number, nonce, time, miner}, txs}
+	// Encoding the TXs can't fail, they hold no unsupported types
+	txRoot, _ := TxRoot(txs)
+
+	return Block{BlockHeader{parent, number, nonce, time, miner, txRoot, nil}, txs}
 }
 
-func (b Block) Hash() (Hash, error) {
-	blockJson, err := json.Marshal(b)
+// TxRoot is the hash of the sorted hashes of the `txs`, empty without TXs.
+// The TXs order doesn't matter as they are applied sorted by time.
+func TxRoot(txs []SignedTx) (Hash, error) {
+	if len(txs) == 0 {
+		return Hash{}, nil
+	}
+
+	txHashes := make([]Hash, 0, len(txs))
+	for _, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return Hash{}, err
+		}
+
+		txHashes = append(txHashes, txHash)
+	}
+
+	sort.Slice(txHashes, func(i, j int) bool {
+		return bytes.Compare(txHashes[i][:], txHashes[j][:]) < 0
+	})
+
+	sortedHashes := make([]byte, 0, len(txHashes)*len(Hash{}))
+	for _, txHash := range txHashes {
+		sortedHashes = append(sortedHashes, txHash[:]...)
+	}
+
+	return sha256.Sum256(sortedHashes), nil
+}
+
+// Hash is the block hash. It covers the TXs payload through the TX root.
+func (h BlockHeader) Hash() (Hash, error) {
+	headerJson, err := json.Marshal(h)
 	if err != nil {
 		return Hash{}, err
 	}
 
-	return sha256.Sum256(blockJson), nil
+	return sha256.Sum256(headerJson), nil
 }
 
-func IsBlockHashValid(hash Hash) bool {
-	return fmt.Sprintf("%x", hash[0]) == "0" &&
-		fmt.Sprintf("%x", hash[1]) == "0" &&
-		fmt.Sprintf("%x", hash[2]) == "0" &&
-		fmt.Sprintf("%x", hash[3]) != "0"
+// SealHash is the hash of the header without its seal signature, the hash
+// signed by the consensus engines signing the blocks. It is the block hash
+// of the unsigned blocks.
+func (h BlockHeader) SealHash() (Hash, error) {
+	h.Signature = nil
+
+	return h.Hash()
+}
+
+// Hash is the hash of the block header, see BlockHeader.Hash.
+func (b Block) Hash() (Hash, error) {
+	return b.Header.Hash()
+}
+
+// SealHash is the seal hash of the block header, see BlockHeader.SealHash.
+func (b Block) SealHash() (Hash, error) {
+	return b.Header.SealHash()
+}
+
+// VerifyTxRoot checks the TXs payload is the one the header commits to.
+func (b Block) VerifyTxRoot() error {
+	txRoot, err := TxRoot(b.TXs)
+	if err != nil {
+		return err
+	}
+
+	if txRoot != b.Header.TxRoot {
+		return fmt.Errorf(
+			"block '%d' TX root '%x' doesn't match header TX root '%x'",
+			b.Header.Number,
+			txRoot,
+			b.Header.TxRoot)
+	}
+
+	return nil
+}
+
+// VerifyHeaderChain checks the headers are linked one after another on top
+// of the `parent` block, that the hashes their peer claims are theirs and
+// that they were sealed following the `verifier` rules.
+//
+// The header commits to the TXs payload through its TX root, so the blocks
+// must still be checked against their header with VerifyBlockAgainstHeader
+// once downloaded.
+func VerifyHeaderChain(
+	parent Hash,
+	nextNumber uint64,
+	headers []BlockHeaderFS,
+	verifier HeaderVerifier) error {
+	for _, h := range headers {
+		if h.Value.Number != nextNumber {
+			return fmt.Errorf(
+				"next expected header must be '%d' not '%d'",
+				nextNumber,
+				h.Value.Number)
+		}
+
+		if h.Value.Parent != parent {
+			return fmt.Errorf(
+				"header '%d' parent hash must be '%x' not '%x'",
+				h.Value.Number,
+				parent,
+				h.Value.Parent)
+		}
+
+		hash, err := h.Value.Hash()
+		if err != nil {
+			return err
+		}
+
+		if hash != h.Key {
+			return fmt.Errorf(
+				"header '%d' hash is '%x' not the claimed '%x'",
+				h.Value.Number,
+				hash,
+				h.Key)
+		}
+
+		sealHash, err := h.Value.SealHash()
+		if err != nil {
+			return err
+		}
+
+		err = verifier.VerifyHeader(h.Value, sealHash)
+		if err != nil {
+			return err
+		}
+
+		parent = h.Key
+		nextNumber++
+	}
+
+	return nil
+}
+
+// VerifyBlockAgainstHeader checks the block is the one the header claims,
+// TXs payload included.
+func VerifyBlockAgainstHeader(b Block, header BlockHeaderFS) error {
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+
+	if hash != header.Key {
+		return fmt.Errorf(
+			"block '%d' hash '%x' doesn't match header hash '%x'",
+			b.Header.Number,
+			hash,
+			header.Key)
+	}
+
+	return b.VerifyTxRoot()
 }
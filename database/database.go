@@ -8,39 +8,176 @@ import (
 )
 
 func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
-	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
+	blocks, _, err := GetBlocksAfterWithLimit(blockHash, dataDir, 0)
 	if err != nil {
 		return nil, err
 	}
 
+	return blocks, nil
+}
+
+// GetBlocksAfterWithLimit returns at most `limit` blocks persisted after
+// the `blockHash` block and whether there are more blocks left to read.
+//
+// A `limit` of 0 returns all the blocks after `blockHash`.
+func GetBlocksAfterWithLimit(
+	blockHash Hash,
+	dataDir string,
+	limit int) ([]Block, bool, error) {
 	blocks := make([]Block, 0)
+
+	hasMore, err := scanBlocksAfter(blockHash, dataDir, limit, func(blockFs BlockFS) {
+		blocks = append(blocks, blockFs.Value)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return blocks, hasMore, nil
+}
+
+// GetBlockHeadersAfterWithLimit works like GetBlocksAfterWithLimit but
+// returns only the block hashes and headers, without the TXs payload.
+func GetBlockHeadersAfterWithLimit(
+	blockHash Hash,
+	dataDir string,
+	limit int) ([]BlockHeaderFS, bool, error) {
+	headers := make([]BlockHeaderFS, 0)
+
+	hasMore, err := scanBlocksAfter(blockHash, dataDir, limit, func(blockFs BlockFS) {
+		headers = append(headers, BlockHeaderFS{blockFs.Key, blockFs.Value.Header})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return headers, hasMore, nil
+}
+
+func scanBlocksAfter(
+	blockHash Hash,
+	dataDir string,
+	limit int,
+	collect func(BlockFS)) (bool, error) {
+	collected := 0
+	hasMore := false
 	shouldStartCollecting := false
 
 	if reflect.DeepEqual(blockHash, Hash{}) {
 		shouldStartCollecting = true
 	}
 
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		if shouldStartCollecting {
+			if limit > 0 && collected == limit {
+				hasMore = true
+				return false
+			}
+
+			collect(blockFs)
+			collected++
+			return true
+		}
+
+		if blockHash == blockFs.Key {
+			shouldStartCollecting = true
+		}
+
+		return true
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return hasMore, nil
+}
+
+// GetBlockByNumber returns the block with the given number, if persisted.
+func GetBlockByNumber(number uint64, dataDir string) (BlockFS, bool, error) {
+	var found BlockFS
+	isFound := false
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		if blockFs.Value.Header.Number == number {
+			found = blockFs
+			isFound = true
+		}
+
+		return !isFound
+	})
+	if err != nil {
+		return BlockFS{}, false, err
+	}
+
+	return found, isFound, nil
+}
+
+// GetBlockByHash returns the block with the given hash, if persisted.
+func GetBlockByHash(hash Hash, dataDir string) (BlockFS, bool, error) {
+	var found BlockFS
+	isFound := false
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		if blockFs.Key == hash {
+			found = blockFs
+			isFound = true
+		}
+
+		return !isFound
+	})
+	if err != nil {
+		return BlockFS{}, false, err
+	}
+
+	return found, isFound, nil
+}
+
+// GetBlocksByNumberRange returns the persisted blocks numbered from
+// `from` to `to`, both included.
+func GetBlocksByNumberRange(from, to uint64, dataDir string) ([]BlockFS, error) {
+	blocks := make([]BlockFS, 0)
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		number := blockFs.Value.Header.Number
+
+		if number >= from && number <= to {
+			blocks = append(blocks, blockFs)
+		}
+
+		return number < to
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// forEachBlock walks the persisted blocks in order until `visit`
+// returns false.
+func forEachBlock(dataDir string, visit func(BlockFS) bool) error {
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		if err := scanner.Err(); err != nil {
-			return nil, err
+			return err
 		}
 
 		var blockFs BlockFS
 		err = json.Unmarshal(scanner.Bytes(), &blockFs)
 		if err != nil {
-			return nil, err
-		}
-
-		if shouldStartCollecting {
-			blocks = append(blocks, blockFs.Value)
-			continue
+			return err
 		}
 
-		if blockHash == blockFs.Key {
-			shouldStartCollecting = true
+		if !visit(blockFs) {
+			return nil
 		}
 	}
 
-	return blocks, nil
+	return nil
 }
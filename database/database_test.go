@@ -0,0 +1,248 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+)
+
+func TestGetBlocksAfterWithLimit(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes, err := writeTestBlocks(dataDir, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, hasMore, err := GetBlocksAfterWithLimit(Hash{}, dataDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || !hasMore {
+		t.Fatalf("expected 2 blocks and more to come, got %d, %v", len(blocks), hasMore)
+	}
+	if blocks[0].Header.Number != 0 || blocks[1].Header.Number != 1 {
+		t.Fatal("first page should contain blocks 0 and 1")
+	}
+
+	blocks, hasMore, err = GetBlocksAfterWithLimit(hashes[1], dataDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || !hasMore || blocks[0].Header.Number != 2 {
+		t.Fatal("second page should contain blocks 2 and 3 and more to come")
+	}
+
+	blocks, hasMore, err = GetBlocksAfterWithLimit(hashes[3], dataDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || hasMore || blocks[0].Header.Number != 4 {
+		t.Fatal("last page should contain only block 4")
+	}
+
+	blocks, err = GetBlocksAfter(Hash{}, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 {
+		t.Fatalf("expected all 5 blocks without a limit, got %d", len(blocks))
+	}
+}
+
+// writeTestBlocks appends `count` linked blocks to the DB file without
+// validating them, returning their hashes in order.
+func writeTestBlocks(dataDir string, count int) ([]Hash, error) {
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make([]Hash, 0, count)
+	parent := Hash{}
+
+	for i := 0; i < count; i++ {
+		b := NewBlock(parent, uint64(i), 0, uint64(i), NewAccount(""), nil)
+		hash, err := b.Hash()
+		if err != nil {
+			return nil, err
+		}
+
+		blockFsJson, err := json.Marshal(BlockFS{hash, b})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = f.Write(append(blockFsJson, '\n'))
+		if err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, hash)
+		parent = hash
+	}
+
+	return hashes, nil
+}
+
+func TestVerifyHeaderChain(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = writeTestBlocks(dataDir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers, _, err := GetBlockHeadersAfterWithLimit(Hash{}, dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = VerifyHeaderChain(Hash{}, 0, headers, testVerifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = VerifyHeaderChain(Hash{}, 0, headers, testVerifier{fmt.Errorf("invalid seal")})
+	if err == nil {
+		t.Fatal("headers not sealed following the consensus rules should be invalid")
+	}
+
+	err = VerifyHeaderChain(Hash{}, 1, headers, testVerifier{})
+	if err == nil {
+		t.Fatal("headers not starting at the next block number should be invalid")
+	}
+
+	// The claimed hash must be the header one, for the seal to be checked
+	forged := headers[2]
+	forged.Value.Nonce++
+	err = VerifyHeaderChain(headers[1].Key, 2, []BlockHeaderFS{forged}, testVerifier{})
+	if err == nil {
+		t.Fatal("headers not matching their claimed hash should be invalid")
+	}
+
+	headers[1].Value.Parent = Hash{}
+	err = VerifyHeaderChain(headers[0].Key, 1, headers[1:], testVerifier{})
+	if err == nil {
+		t.Fatal("headers not linked to their parent should be invalid")
+	}
+}
+
+func TestVerifyBlockAgainstHeader(t *testing.T) {
+	tx, _ := newTestSignedTx(t)
+	b := NewBlock(Hash{}, 0, 0, 0, NewAccount(""), []SignedTx{tx})
+
+	hash, err := b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := BlockHeaderFS{hash, b.Header}
+
+	err = VerifyBlockAgainstHeader(b, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header commits to the TXs, they can't be swapped
+	otherTx, _ := newTestSignedTx(t)
+	tampered := b
+	tampered.TXs = []SignedTx{otherTx}
+
+	err = VerifyBlockAgainstHeader(tampered, header)
+	if err == nil {
+		t.Fatal("block with other TXs than its header commits to should be invalid")
+	}
+
+	// The TX root doesn't depend on the TXs order
+	reordered := NewBlock(Hash{}, 0, 0, 0, NewAccount(""), []SignedTx{otherTx, tx})
+	txRoot, err := TxRoot([]SignedTx{tx, otherTx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reordered.Header.TxRoot != txRoot {
+		t.Fatal("TX root should be the same whatever the TXs order")
+	}
+}
+
+func TestGetBlocksByNumberAndHash(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes, err := writeTestBlocks(dataDir, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockFs, found, err := GetBlockByNumber(3, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || blockFs.Key != hashes[3] {
+		t.Fatal("block 3 should be found by its number")
+	}
+
+	blockFs, found, err = GetBlockByHash(hashes[2], dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || blockFs.Value.Header.Number != 2 {
+		t.Fatal("block 2 should be found by its hash")
+	}
+
+	_, found, err = GetBlockByNumber(10, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Fatal("block 10 doesn't exist")
+	}
+
+	blocks, err := GetBlocksByNumberRange(1, 3, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 || blocks[0].Key != hashes[1] || blocks[2].Key != hashes[3] {
+		t.Fatal("range should contain blocks 1 to 3")
+	}
+}
+
+// testVerifier answers every header verification with its err.
+type testVerifier struct {
+	err error
+}
+
+func (v testVerifier) VerifyHeader(header BlockHeader, sealHash Hash) error {
+	return v.err
+}
@@ -38,6 +38,10 @@ func getBlocksDbFilePath(dataDir string) string {
 	return filepath.Join(getDatabaseDirPath(dataDir), "block.db")
 }
 
+func getTxIndexDbFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "tx_index.db")
+}
+
 func fileExist(filePath string) bool {
 	_, err := os.Stat(filePath)
 	if err != nil && os.IsNotExist(err) {
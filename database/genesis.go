@@ -17,7 +17,27 @@ var genesisJson = `
 }`
 
 type Genesis struct {
-	Balances map[common.Address]uint `json:"balances"`
+	Balances  map[common.Address]uint `json:"balances"`
+	Consensus ConsensusConfig         `json:"consensus"`
+}
+
+// ConsensusConfig selects the engine sealing the blocks of the chain: pow,
+// the default, poa or dev. The poa engine lets the Signers node accounts
+// seal the blocks in turn.
+type ConsensusConfig struct {
+	Engine  string           `json:"engine,omitempty"`
+	Signers []common.Address `json:"signers,omitempty"`
+}
+
+// LoadGenesis loads the genesis of the `dataDir` chain, initializing the
+// data dir with the default genesis if needed.
+func LoadGenesis(dataDir string) (Genesis, error) {
+	err := InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		return Genesis{}, err
+	}
+
+	return loadGenesis(getGenesisJsonFilePath(dataDir))
 }
 
 func loadGenesis(path string) (Genesis, error) {
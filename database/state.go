@@ -3,31 +3,54 @@ package database
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"sort"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
 )
 
+// ErrBlockNotNext is returned by AddBlock when the block doesn't extend the
+// latest block, e.g. another block with its number was added meanwhile.
+var ErrBlockNotNext = errors.New("block doesn't extend the latest block")
+
+// ErrTxAlreadyIncluded is returned when a TX is already included in the
+// chain. TXs have no nonce, so a mined TX must never be applied again.
+var ErrTxAlreadyIncluded = errors.New("TX is already included in the chain")
+
+// State is safe for concurrent use: the blocks are committed one at a time
+// and the readers never see a block half applied.
 type State struct {
+	// Balances is only safe to read before the State is shared, use
+	// Balance or BalancesCopy after
 	Balances map[common.Address]uint
 
-	dbFile *os.File
+	mu sync.RWMutex
+
+	dbFile      *os.File
+	txIndexFile *os.File
+	txIndex     map[Hash]TxIndexEntry
 
 	latestBlock     Block
 	latestBlockHash Hash
 	hasGenesisBlock bool
-}
 
-func NewStateFromDisk(dataDir string) (*State, error) {
-	err := InitDataDirIfNotExists(dataDir, []byte(genesisJson))
-	if err != nil {
-		return nil, err
-	}
+	verifier HeaderVerifier
 
-	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
+	logger log.Logger
+}
+
+// NewStateFromDisk replays the blocks of the `dataDir` chain, checking they
+// were sealed following the `verifier` consensus rules.
+//
+// The persisted TXs index is loaded and only the blocks after its latest
+// indexed block are indexed, unless it was built from another chain.
+func NewStateFromDisk(dataDir string, verifier HeaderVerifier, logger log.Logger) (*State, error) {
+	gen, err := LoadGenesis(dataDir)
 	if err != nil {
 		return nil, err
 	}
@@ -43,9 +66,27 @@ func NewStateFromDisk(dataDir string) (*State, error) {
 		return nil, err
 	}
 
+	txIndex, err := loadTxIndexDb(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The entries of the blocks missing from the persisted TXs index
+	unindexedEntries := make([]TxIndexEntry, 0)
+	// The replayed blocks are indexed apart from the persisted index, for
+	// applyBlock to reject the TXs included twice in this chain only
+	replayedIndex := make(map[Hash]TxIndexEntry)
+	isTxIndexStale := false
+
 	scanner := bufio.NewScanner(f)
 
-	state := &State{balances, f, Block{}, Hash{}, false}
+	state := &State{
+		Balances: balances,
+		dbFile:   f,
+		txIndex:  replayedIndex,
+		verifier: verifier,
+		logger:   logger,
+	}
 
 	for scanner.Scan() {
 		if err := scanner.Err(); err != nil {
@@ -69,11 +110,60 @@ func NewStateFromDisk(dataDir string) (*State, error) {
 			return nil, err
 		}
 
+		entries, err := state.indexTXs(blockFs.Value, blockFs.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		isIndexed, isStale := txIndex.isIndexed(blockFs)
+		isTxIndexStale = isTxIndexStale || isStale
+
+		if !isIndexed {
+			unindexedEntries = append(unindexedEntries, entries...)
+		}
+
 		state.latestBlock = blockFs.Value
 		state.latestBlockHash = blockFs.Key
 		state.hasGenesisBlock = true
 	}
 
+	// The persisted TXs index is ahead of the chain
+	if txIndex.hasLatest &&
+		(!state.hasGenesisBlock || txIndex.latest.BlockNumber > state.latestBlock.Header.Number) {
+		isTxIndexStale = true
+	}
+
+	if isTxIndexStale {
+		logger.Warn("Rebuilding the stale TXs index")
+	} else {
+		for _, entry := range unindexedEntries {
+			txIndex.entries[entry.TxHash] = entry
+		}
+		state.txIndex = txIndex.entries
+	}
+
+	// The index is rewritten whole rather than appended to if stale or if
+	// the node stopped while indexing a block
+	rewriteTxIndex := isTxIndexStale || txIndex.hasPartialBlock
+
+	entries := unindexedEntries
+	if rewriteTxIndex {
+		entries = make([]TxIndexEntry, 0, len(state.txIndex))
+		for _, entry := range state.txIndex {
+			entries = append(entries, entry)
+		}
+	}
+
+	isLatestIndexed := txIndex.hasLatest && txIndex.latest.BlockHash == state.latestBlockHash
+	if state.hasGenesisBlock && (rewriteTxIndex || !isLatestIndexed) {
+		entries = append(entries, newTxIndexBlockMarker(state.latestBlockHash, state.latestBlock.Header.Number))
+	}
+
+	state.txIndexFile, err = openTxIndexDb(dataDir, entries, rewriteTxIndex)
+	if err != nil {
+		return nil, err
+	}
+
 	return state, nil
 }
 
@@ -88,10 +178,16 @@ func (s *State) AddBlocks(blocks []Block) error {
 	return nil
 }
 
+// AddBlock applies the `b` block on top of the latest block and persists
+// it. The block number and parent are checked while holding the State lock,
+// so of two blocks with the same number only the first is added.
 func (s *State) AddBlock(b Block) (Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	pendingState := s.copy()
 
-	err := applyBlock(b, &pendingState)
+	err := applyBlock(b, pendingState)
 	if err != nil {
 		return Hash{}, err
 	}
@@ -108,8 +204,8 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 		return Hash{}, err
 	}
 
-	fmt.Printf("\nPersisting new Block to disk:\n")
-	fmt.Printf("\t%s\n", blockFsJson)
+	s.logger.Info("Persisting new block", "number", b.Header.Number, "hash", blockHash.Hex())
+	s.logger.Trace("Persisting new block", "block", string(blockFsJson))
 
 	_, err = s.dbFile.Write(append(blockFsJson, '\n'))
 	if err != nil {
@@ -121,34 +217,121 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 	s.latestBlock = b
 	s.hasGenesisBlock = true
 
+	entries, err := newTxIndexEntries(b, blockHash)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	for _, entry := range append(entries, newTxIndexBlockMarker(blockHash, b.Header.Number)) {
+		if !entry.isBlockMarker() {
+			s.txIndex[entry.TxHash] = entry
+		}
+
+		err = writeTxIndexEntry(s.txIndexFile, entry)
+		if err != nil {
+			return Hash{}, err
+		}
+	}
+
 	return blockHash, nil
 }
 
+// GetTxIndexEntry returns in what block the TX was included, if any.
+func (s *State) GetTxIndexEntry(txHash Hash) (TxIndexEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, isIncluded := s.txIndex[txHash]
+
+	return entry, isIncluded
+}
+
+func (s *State) indexTXs(b Block, blockHash Hash) ([]TxIndexEntry, error) {
+	entries, err := newTxIndexEntries(b, blockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		s.txIndex[entry.TxHash] = entry
+	}
+
+	return entries, nil
+}
+
 func (s *State) NextBlockNumber() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if !s.hasGenesisBlock {
 		return uint64(0)
 	}
 
-	return s.LatestBlock().Header.Number + 1
+	return s.latestBlock.Header.Number + 1
 }
 
 func (s *State) LatestBlock() Block {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.latestBlock
 }
 
 func (s *State) LatestBlockHash() Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.latestBlockHash
 }
 
+// Balance returns the `account` balance after the latest block.
+func (s *State) Balance(account common.Address) uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.Balances[account]
+}
+
+// BalancesCopy returns the balances after the latest block.
+func (s *State) BalancesCopy() map[common.Address]uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balances := make(map[common.Address]uint, len(s.Balances))
+	for account, balance := range s.Balances {
+		balances[account] = balance
+	}
+
+	return balances
+}
+
+// Close flushes the blocks DB and TX index to disk before closing them.
 func (s *State) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.txIndexFile != nil {
+		s.txIndexFile.Sync()
+		s.txIndexFile.Close()
+	}
+
+	err := s.dbFile.Sync()
+	if err != nil {
+		s.dbFile.Close()
+		return err
+	}
+
 	return s.dbFile.Close()
 }
 
-func (s *State) copy() State {
-	c := State{}
+func (s *State) copy() *State {
+	c := &State{}
 	c.hasGenesisBlock = s.hasGenesisBlock
 	c.latestBlock = s.latestBlock
 	c.latestBlockHash = s.latestBlockHash
+	c.verifier = s.verifier
+	// Only read by applyBlock, the entries of the block are added on commit
+	c.txIndex = s.txIndex
 	c.Balances = make(map[common.Address]uint)
 
 	for acc, balance := range s.Balances {
@@ -166,7 +349,8 @@ func applyBlock(b Block, s *State) error {
 
 	if s.hasGenesisBlock && b.Header.Number != nextExpectedBlockNumber {
 		return fmt.Errorf(
-			"next expected block must be '%d' not '%d'",
+			"%w, next expected block must be '%d' not '%d'",
+			ErrBlockNotNext,
 			nextExpectedBlockNumber,
 			b.Header.Number)
 	}
@@ -175,18 +359,30 @@ func applyBlock(b Block, s *State) error {
 		s.latestBlock.Header.Number > 0 &&
 		!reflect.DeepEqual(b.Header.Parent, s.latestBlockHash) {
 		return fmt.Errorf(
-			"next block parent hash must be '%x' not '%x'",
+			"%w, next block parent hash must be '%x' not '%x'",
+			ErrBlockNotNext,
 			s.latestBlockHash,
 			b.Header.Parent)
 	}
 
-	hash, err := b.Hash()
+	sealHash, err := b.SealHash()
 	if err != nil {
 		return err
 	}
 
-	if !IsBlockHashValid(hash) {
-		return fmt.Errorf("invalid block hash %x", hash)
+	err = s.verifier.VerifyHeader(b.Header, sealHash)
+	if err != nil {
+		return err
+	}
+
+	err = b.VerifyTxRoot()
+	if err != nil {
+		return err
+	}
+
+	err = verifyTXsNotIncluded(b.TXs, s)
+	if err != nil {
+		return err
 	}
 
 	err = applyTXs(b.TXs, s)
@@ -199,6 +395,35 @@ func applyBlock(b Block, s *State) error {
 	return nil
 }
 
+// verifyTXsNotIncluded rejects the TXs already included in the chain or
+// twice in the block, as applying them would move the funds again.
+func verifyTXsNotIncluded(txs []SignedTx, s *State) error {
+	blockTXs := make(map[Hash]struct{}, len(txs))
+
+	for _, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+
+		if entry, isIncluded := s.txIndex[txHash]; isIncluded {
+			return fmt.Errorf(
+				"%w, TX '%s' was included in block %d",
+				ErrTxAlreadyIncluded,
+				txHash.Hex(),
+				entry.BlockNumber)
+		}
+
+		if _, isDuplicate := blockTXs[txHash]; isDuplicate {
+			return fmt.Errorf(
+				"%w, TX '%s' is twice in the block", ErrTxAlreadyIncluded, txHash.Hex())
+		}
+		blockTXs[txHash] = struct{}{}
+	}
+
+	return nil
+}
+
 func applyTXs(txs []SignedTx, s *State) error {
 	sort.Slice(txs, func(i, j int) bool {
 		return txs[i].Time < txs[j].Time
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+)
+
+func TestState_AddBlockConcurrently(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks with the same number, e.g. mined by the node and submitted by
+	// an external miner at once
+	const competingBlocks = 8
+	errs := make(chan error, competingBlocks)
+
+	var adding sync.WaitGroup
+	for i := 0; i < competingBlocks; i++ {
+		adding.Add(1)
+		go func(i int) {
+			defer adding.Done()
+
+			_, err := state.AddBlock(NewBlock(Hash{}, 0, uint32(i), 0, NewAccount(""), nil))
+			errs <- err
+		}(i)
+	}
+	adding.Wait()
+	close(errs)
+
+	added := 0
+	for err := range errs {
+		if err == nil {
+			added++
+			continue
+		}
+
+		if !errors.Is(err, ErrBlockNotNext) {
+			t.Fatalf("expected ErrBlockNotNext, got %s", err)
+		}
+	}
+
+	if added != 1 {
+		t.Fatalf("only one of the competing blocks should be added, %d were", added)
+	}
+
+	err = state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain on disk is still valid
+	state, err = NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.NextBlockNumber() != 1 {
+		t.Fatalf("expected 1 block on disk, got next block %d", state.NextBlockNumber())
+	}
+}
+
+func TestState_AddBlockRejectsIncludedTXs(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, _ := newTestSignedTx(t)
+	_, err = state.AddBlock(NewBlock(Hash{}, 0, 0, 0, NewAccount(""), []SignedTx{tx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	// The index is reloaded from disk, the TX stays known after a restart
+	state, err = NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), 1, 0, 0, NewAccount(""), []SignedTx{tx}))
+	if !errors.Is(err, ErrTxAlreadyIncluded) {
+		t.Fatalf("expected ErrTxAlreadyIncluded for a mined TX, got %v", err)
+	}
+
+	otherTx, _ := newTestSignedTx(t)
+	_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), 1, 0, 0, NewAccount(""), []SignedTx{otherTx, otherTx}))
+	if !errors.Is(err, ErrTxAlreadyIncluded) {
+		t.Fatalf("expected ErrTxAlreadyIncluded for a TX twice in the block, got %v", err)
+	}
+
+	if state.NextBlockNumber() != 1 {
+		t.Fatalf("the rejected blocks shouldn't be added, next block is %d", state.NextBlockNumber())
+	}
+}
+
+func TestState_AddBlockVerifiesTxRoot(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	// The TX is added after the block was sealed without it
+	tx, _ := newTestSignedTx(t)
+	b := NewBlock(Hash{}, 0, 0, 0, NewAccount(""), nil)
+	b.TXs = []SignedTx{tx}
+
+	_, err = state.AddBlock(b)
+	if err == nil {
+		t.Fatal("block with other TXs than its header commits to should be rejected")
+	}
+
+	if state.NextBlockNumber() != 0 {
+		t.Fatal("the rejected block shouldn't be added")
+	}
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// TxIndexEntry locates the block a TX was included in.
+//
+// In the TX index file the entries of every indexed block are followed by
+// a block marker, an entry without TX hash. The last marker is the latest
+// block fully indexed.
+type TxIndexEntry struct {
+	TxHash      Hash   `json:"tx_hash"`
+	BlockHash   Hash   `json:"block_hash"`
+	BlockNumber uint64 `json:"block_number"`
+}
+
+func newTxIndexEntries(b Block, blockHash Hash) ([]TxIndexEntry, error) {
+	entries := make([]TxIndexEntry, 0, len(b.TXs))
+
+	for _, tx := range b.TXs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, TxIndexEntry{txHash, blockHash, b.Header.Number})
+	}
+
+	return entries, nil
+}
+
+func newTxIndexBlockMarker(blockHash Hash, number uint64) TxIndexEntry {
+	return TxIndexEntry{BlockHash: blockHash, BlockNumber: number}
+}
+
+func (e TxIndexEntry) isBlockMarker() bool {
+	return e.TxHash.IsEmpty()
+}
+
+// txIndexDb is the TX index persisted in the data dir.
+type txIndexDb struct {
+	entries map[Hash]TxIndexEntry
+
+	// latest marks the latest block fully indexed, if hasLatest
+	latest    TxIndexEntry
+	hasLatest bool
+
+	// hasPartialBlock is set when the node stopped while indexing the block
+	// after latest, its entries were dropped
+	hasPartialBlock bool
+}
+
+// isIndexed tells whether the `blockFs` block is covered by the index and
+// whether the index is stale, i.e. was built from another chain.
+func (db txIndexDb) isIndexed(blockFs BlockFS) (isIndexed bool, isStale bool) {
+	if !db.hasLatest || blockFs.Value.Header.Number > db.latest.BlockNumber {
+		return false, false
+	}
+
+	isStale = blockFs.Value.Header.Number == db.latest.BlockNumber &&
+		blockFs.Key != db.latest.BlockHash
+
+	return true, isStale
+}
+
+// loadTxIndexDb reads the TXs index persisted in the data dir, allowing
+// TX lookups without replaying the whole blockchain.
+func loadTxIndexDb(dataDir string) (txIndexDb, error) {
+	db := txIndexDb{entries: make(map[Hash]TxIndexEntry)}
+
+	f, err := os.OpenFile(getTxIndexDbFilePath(dataDir), os.O_RDONLY, 0600)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return txIndexDb{}, err
+	}
+	defer f.Close()
+
+	// The entries of a block are only kept once its marker is read
+	blockEntries := make([]TxIndexEntry, 0)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return txIndexDb{}, err
+		}
+
+		var entry TxIndexEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return txIndexDb{}, err
+		}
+
+		if !entry.isBlockMarker() {
+			blockEntries = append(blockEntries, entry)
+			continue
+		}
+
+		for _, blockEntry := range blockEntries {
+			db.entries[blockEntry.TxHash] = blockEntry
+		}
+		blockEntries = blockEntries[:0]
+
+		db.latest = entry
+		db.hasLatest = true
+	}
+
+	db.hasPartialBlock = len(blockEntries) > 0
+
+	return db, nil
+}
+
+// openTxIndexDb appends the `entries`, ending with a block marker, to the
+// persisted TXs index, or rewrites the index with them if `rewrite`.
+func openTxIndexDb(dataDir string, entries []TxIndexEntry, rewrite bool) (*os.File, error) {
+	flags := os.O_APPEND | os.O_CREATE | os.O_RDWR
+	if rewrite {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(getTxIndexDbFilePath(dataDir), flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		err = writeTxIndexEntry(f, entry)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func writeTxIndexEntry(f *os.File, entry TxIndexEntry) error {
+	entryJson, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(entryJson, '\n'))
+
+	return err
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+)
+
+func TestNewStateFromDiskLoadsTxIndex(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txHashes := make([]Hash, 0)
+	for i := 0; i < 2; i++ {
+		tx, txHash := newTestSignedTx(t)
+		txHashes = append(txHashes, txHash)
+
+		_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), 0, 0, NewAccount(""), []SignedTx{tx}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	state.Close()
+
+	// An entry only found in the persisted index proves it is loaded
+	// rather than rebuilt
+	f, err := os.OpenFile(getTxIndexDbFilePath(dataDir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := state.LatestBlock().Hash()
+	writeTxIndexEntry(f, TxIndexEntry{Hash{7}, latest, 1})
+	writeTxIndexEntry(f, newTxIndexBlockMarker(latest, 1))
+	f.Close()
+
+	state, err = NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, isIncluded := state.GetTxIndexEntry(Hash{7}); !isIncluded {
+		t.Fatal("TXs index should be loaded from the data dir")
+	}
+
+	// The node stops after persisting a block but before indexing it
+	tx, txHash := newTestSignedTx(t)
+	txHashes = append(txHashes, txHash)
+
+	_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), 0, 0, NewAccount(""), []SignedTx{tx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	err = removeLastLines(getTxIndexDbFilePath(dataDir), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	db, err := loadTxIndexDb(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := db.entries
+
+	if _, isIndexed := index[Hash{7}]; !isIndexed {
+		t.Fatal("missing blocks should be appended to the TXs index, not rewrite it")
+	}
+
+	for i, txHash := range txHashes {
+		entry, isIndexed := index[txHash]
+		if !isIndexed || entry.BlockNumber != uint64(i) {
+			t.Fatalf("TX of block %d should be indexed, got %+v", i, entry)
+		}
+	}
+}
+
+func TestNewStateFromDiskRebuildsStaleTxIndex(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "sb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = InitDataDirIfNotExists(dataDir, []byte(genesisJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staleTx, staleTxHash := newTestSignedTx(t)
+	_, err = state.AddBlock(NewBlock(Hash{}, 0, 0, 0, NewAccount(""), []SignedTx{staleTx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	// Another chain of the same length replaces the blocks
+	err = writeEmptyBlocksDbToDisk(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, txHash := newTestSignedTx(t)
+	_, err = state.AddBlock(NewBlock(Hash{}, 0, 0, 0, NewAccount(""), []SignedTx{tx}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	state, err = NewStateFromDisk(dataDir, testVerifier{}, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if _, isIncluded := state.GetTxIndexEntry(staleTxHash); isIncluded {
+		t.Fatal("TXs of another chain should be dropped from the index")
+	}
+
+	if _, isIncluded := state.GetTxIndexEntry(txHash); !isIncluded {
+		t.Fatal("TXs of the chain should be indexed")
+	}
+}
+
+// newTestSignedTx signs a TX from a new account, its zero value needing no
+// balance.
+func newTestSignedTx(t *testing.T) (SignedTx, Hash) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewTx(crypto.PubkeyToAddress(key.PublicKey), NewAccount(""), 0, "")
+
+	unsignedHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := crypto.Sign(unsignedHash[:], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedTx := NewSignedTx(tx, sig)
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signedTx, txHash
+}
+
+func removeLastLines(path string, count int) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	end := len(content)
+	for i := 0; i < count; i++ {
+		end = lastLineStart(content[:end])
+	}
+
+	return ioutil.WriteFile(path, content[:end], 0600)
+}
+
+func lastLineStart(content []byte) int {
+	for i := len(content) - 2; i >= 0; i-- {
+		if content[i] == '\n' {
+			return i + 1
+		}
+	}
+
+	return 0
+}
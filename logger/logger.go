@@ -0,0 +1,65 @@
+// Package logger builds the levelled, structured loggers of the node.
+//
+// Every subsystem logs through its own logger, tagging the records with
+// the `subsystem` key so they can be filtered.
+package logger
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const FormatTerminal = "terminal"
+const FormatJson = "json"
+
+const DefaultLevel = "info"
+const DefaultFormat = FormatTerminal
+
+const subsystemKey = "subsystem"
+
+const SubsystemNode = "node"
+const SubsystemDb = "db"
+const SubsystemSync = "sync"
+const SubsystemMiner = "miner"
+const SubsystemHttp = "http"
+const SubsystemPeers = "peers"
+
+// New creates a logger writing the records of at least `level` to `w`,
+// formatted as `format`.
+func New(w io.Writer, level string, format string) (log.Logger, error) {
+	lvl, err := log.LvlFromString(level)
+	if err != nil {
+		return nil, err
+	}
+
+	var fmtr log.Format
+	switch format {
+	case FormatTerminal:
+		fmtr = log.TerminalFormat(false)
+	case FormatJson:
+		fmtr = log.JSONFormat()
+	default:
+		return nil, fmt.Errorf(
+			"unknown log format '%s', expected '%s' or '%s'", format, FormatTerminal, FormatJson)
+	}
+
+	logger := log.New()
+	logger.SetHandler(log.LvlFilterHandler(lvl, log.StreamHandler(w, fmtr)))
+
+	return logger, nil
+}
+
+// ForSubsystem derives the logger of the `subsystem` from the node one.
+func ForSubsystem(logger log.Logger, subsystem string) log.Logger {
+	return logger.New(subsystemKey, subsystem)
+}
+
+// Discard creates a logger dropping every record, e.g. in tests.
+func Discard() log.Logger {
+	logger := log.New()
+	logger.SetHandler(log.DiscardHandler())
+
+	return logger
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNew_JsonFormatWithSubsystemAndLevel(t *testing.T) {
+	var out bytes.Buffer
+
+	logger, err := New(&out, "info", FormatJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syncLogger := ForSubsystem(logger, SubsystemSync)
+	syncLogger.Debug("Importing blocks")
+	syncLogger.Info("Found new Peer", "peer", "127.0.0.1:8080")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("debug records should be filtered out, got %d records", len(lines))
+	}
+
+	record := make(map[string]interface{})
+	err = json.Unmarshal([]byte(lines[0]), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record["msg"] != "Found new Peer" || record["lvl"] != "info" ||
+		record[subsystemKey] != SubsystemSync || record["peer"] != "127.0.0.1:8080" {
+		t.Fatalf("unexpected record %v", record)
+	}
+}
+
+func TestNew_RejectsUnknownLevelAndFormat(t *testing.T) {
+	var out bytes.Buffer
+
+	_, err := New(&out, "verbose", FormatJson)
+	if err == nil {
+		t.Fatal("unknown level should be rejected")
+	}
+
+	_, err = New(&out, DefaultLevel, "xml")
+	if err == nil {
+		t.Fatal("unknown format should be rejected")
+	}
+}
@@ -0,0 +1,350 @@
+package node
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/client"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const endpointAdmin = "/admin/"
+
+const endpointAdminPeers = "/admin/peers"
+const endpointAdminPeersQueryKeyIP = "ip"
+const endpointAdminPeersQueryKeyPort = "port"
+const endpointAdminPeersQueryKeyBan = "ban"
+
+const endpointAdminMining = "/admin/mining"
+const endpointAdminMiner = "/admin/miner"
+const endpointAdminMempoolFlush = "/admin/mempool/flush"
+
+const adminAuthScheme = "Bearer "
+const maxPeerPort = 65535
+const adminBanReason = "banned by the node admin"
+
+// The admin request and response types shared with the Go SDK.
+type AdminPeersRes = client.AdminPeersRes
+type AdminPeerAddReq = client.AdminPeerAddReq
+type AdminMiningReq = client.AdminMiningReq
+type AdminMinerReq = client.AdminMinerReq
+type AdminMiningRes = client.AdminMiningRes
+type AdminMempoolFlushRes = client.AdminMempoolFlushRes
+
+// requireAdminToken only lets through the requests bearing the admin
+// token. Without a configured token, the admin API is disabled.
+func (n *Node) requireAdminToken(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.adminToken == "" {
+			writeErrResWithStatus(
+				w,
+				fmt.Errorf("the admin API is disabled, no admin token is configured"),
+				http.StatusForbidden)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, adminAuthScheme)
+
+		isValid := strings.HasPrefix(auth, adminAuthScheme) &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(n.adminToken)) == 1
+
+		if !isValid {
+			n.httpLogger.Warn("Rejected admin request", "path", r.URL.Path, "remote", r.RemoteAddr)
+
+			w.Header().Set("WWW-Authenticate", strings.TrimSpace(adminAuthScheme))
+			writeErrResWithStatus(
+				w, fmt.Errorf("a valid admin token is required"), http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func adminPeersHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		req := AdminPeerAddReq{}
+		err := readReq(r, &req)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		peer := NewPeerNode(req.IP, req.Port, false, req.Account, false)
+		peer.TLS = req.TLS
+
+		err = node.adminAddPeer(peer)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+	case http.MethodDelete:
+		peer, ban, err := readAdminPeerQuery(r)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		err = node.adminRemovePeer(peer, ban)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+	}
+
+	writeRes(w, node.adminPeers())
+}
+
+func readAdminPeerQuery(r *http.Request) (PeerNode, bool, error) {
+	ip := r.URL.Query().Get(endpointAdminPeersQueryKeyIP)
+	portRaw := r.URL.Query().Get(endpointAdminPeersQueryKeyPort)
+	banRaw := r.URL.Query().Get(endpointAdminPeersQueryKeyBan)
+
+	port, err := strconv.ParseUint(portRaw, 10, 16)
+	if err != nil {
+		return PeerNode{}, false, newBadReqErr(fmt.Errorf("invalid port '%s'", portRaw))
+	}
+
+	ban := false
+	if banRaw != "" {
+		ban, err = strconv.ParseBool(banRaw)
+		if err != nil {
+			return PeerNode{}, false, newBadReqErr(fmt.Errorf("invalid ban '%s'", banRaw))
+		}
+	}
+
+	return NewPeerNode(ip, port, false, common.Address{}, false), ban, nil
+}
+
+// adminAddPeer adds the `peer` to the KnownPeers, lifting its ban if any.
+//
+// The node handshakes with the Peer on its next sync.
+func (n *Node) adminAddPeer(peer PeerNode) error {
+	if peer.IP == "" || peer.Port == 0 || peer.Port > maxPeerPort {
+		return newBadReqErr(fmt.Errorf("invalid peer address '%s'", peer.TcpAddress()))
+	}
+
+	if peer.IP == n.info.IP && peer.Port == n.info.Port {
+		return newBadReqErr(fmt.Errorf("the node can't be its own peer"))
+	}
+
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	if _, isBanned := n.bannedPeers[peer.TcpAddress()]; isBanned {
+		delete(n.bannedPeers, peer.TcpAddress())
+
+		err := writeBannedPeersToDisk(n.dataDir, n.bannedPeers)
+		if err != nil {
+			return err
+		}
+	}
+
+	if knownPeer, isKnownPeer := n.knownPeers[peer.TcpAddress()]; isKnownPeer {
+		peer.IsBootstrap = knownPeer.IsBootstrap
+		peer.score = knownPeer.score
+	}
+
+	n.knownPeers[peer.TcpAddress()] = peer
+	n.saveKnownPeers()
+
+	n.peersLogger.Info("Admin added peer", "peer", peer.TcpAddress(), "account", peer.Account.String())
+
+	return nil
+}
+
+// adminRemovePeer removes the `peer` from the KnownPeers. Unless banned,
+// the Peer is free to join again.
+func (n *Node) adminRemovePeer(peer PeerNode, ban bool) error {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	knownPeer, isKnownPeer := n.knownPeers[peer.TcpAddress()]
+	if isKnownPeer {
+		peer = knownPeer
+	}
+
+	if ban {
+		n.addBannedPeer(peer, adminBanReason)
+		return nil
+	}
+
+	if !isKnownPeer {
+		return statusErr{
+			http.StatusNotFound, fmt.Errorf("peer '%s' is not known", peer.TcpAddress())}
+	}
+
+	n.removeKnownPeer(peer)
+
+	n.peersLogger.Info("Admin removed peer", "peer", peer.TcpAddress())
+
+	return nil
+}
+
+func (n *Node) adminPeers() AdminPeersRes {
+	// Expired bans are forgotten while listing them
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	res := AdminPeersRes{
+		Known:  make([]client.AdminPeer, 0, len(n.knownPeers)),
+		Banned: make([]client.AdminBannedPeer, 0, len(n.bannedPeers)),
+	}
+
+	for _, tcpAddress := range sortedPeerAddresses(n.knownPeers) {
+		peer := n.knownPeers[tcpAddress]
+		res.Known = append(res.Known, client.AdminPeer{
+			Peer:      peer.clientPeer(),
+			Connected: peer.connected,
+			Score:     peer.score,
+		})
+	}
+
+	for _, bannedPeer := range n.bannedPeers {
+		if n.isBanned(NewPeerNode(bannedPeer.IP, bannedPeer.Port, false, common.Address{}, false)) {
+			res.Banned = append(res.Banned, client.AdminBannedPeer(bannedPeer))
+		}
+	}
+
+	sort.Slice(res.Banned, func(i, j int) bool {
+		return res.Banned[i].Until.Before(res.Banned[j].Until)
+	})
+
+	return res
+}
+
+func sortedPeerAddresses(peers map[string]PeerNode) []string {
+	tcpAddresses := make([]string, 0, len(peers))
+	for tcpAddress := range peers {
+		tcpAddresses = append(tcpAddresses, tcpAddress)
+	}
+	sort.Strings(tcpAddresses)
+
+	return tcpAddresses
+}
+
+func adminMiningHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		req := AdminMiningReq{}
+		err := readReq(r, &req)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		node.setMiningEnabled(req.Enabled)
+	}
+
+	writeRes(w, node.miningStatus())
+}
+
+func adminMinerHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodPost) {
+		return
+	}
+
+	req := AdminMinerReq{}
+	err := readReq(r, &req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	node.setMiner(req.Miner)
+
+	writeRes(w, node.miningStatus())
+}
+
+func adminMempoolFlushHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodPost) {
+		return
+	}
+
+	writeRes(w, AdminMempoolFlushRes{Flushed: node.dropPendingTXs()})
+}
+
+// setMiningEnabled pauses or resumes the miner. Pausing abandons the block
+// being mined, its TXs stay pending.
+func (n *Node) setMiningEnabled(enabled bool) {
+	n.miningMu.Lock()
+	n.miningEnabled = enabled
+	n.miningMu.Unlock()
+
+	if !enabled {
+		n.abandonCurrentMining()
+	}
+
+	n.minerLogger.Info("Admin toggled mining", "enabled", enabled)
+}
+
+// setMiner credits the rewards of the next mined blocks to `miner`.
+func (n *Node) setMiner(miner common.Address) {
+	n.miningMu.Lock()
+	n.miner = miner
+	n.miningMu.Unlock()
+
+	n.minerLogger.Info("Admin changed miner", "miner", miner.String())
+}
+
+func (n *Node) isMiningEnabled() bool {
+	n.miningMu.RLock()
+	defer n.miningMu.RUnlock()
+
+	return n.miningEnabled
+}
+
+func (n *Node) minerAccount() common.Address {
+	n.miningMu.RLock()
+	defer n.miningMu.RUnlock()
+
+	return n.miner
+}
+
+func (n *Node) miningStatus() AdminMiningRes {
+	return AdminMiningRes{
+		Enabled:  n.isMiningEnabled(),
+		IsMining: n.isMining,
+		Miner:    n.minerAccount(),
+	}
+}
+
+// abandonCurrentMining asks the miner to abandon the block being mined, if
+// any, without waiting for it.
+func (n *Node) abandonCurrentMining() {
+	select {
+	case n.miningAbandoned <- struct{}{}:
+	default:
+	}
+}
+
+// dropPendingTXs empties the Mempool and returns how many TXs were dropped.
+//
+// The block being mined is abandoned so the dropped TXs don't get mined.
+func (n *Node) dropPendingTXs() int {
+	n.mempoolMu.Lock()
+	dropped := len(n.pendingTXs)
+	n.pendingTXs = make(map[string]database.SignedTx)
+	n.mempoolMu.Unlock()
+
+	n.abandonCurrentMining()
+
+	n.logger.Info("Admin flushed the mempool", "dropped", dropped)
+
+	return dropped
+}
@@ -0,0 +1,215 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const testAdminToken = "0123456789abcdef"
+
+func TestRequireAdminToken(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	handler := n.requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		writeRes(w, HealthRes{})
+	})
+
+	cases := []struct {
+		adminToken string
+		auth       string
+		status     int
+	}{
+		{"", "Bearer ", http.StatusForbidden},
+		{testAdminToken, "", http.StatusUnauthorized},
+		{testAdminToken, "Bearer 0123456789abcdeF", http.StatusUnauthorized},
+		{testAdminToken, testAdminToken, http.StatusUnauthorized},
+		{testAdminToken, "Bearer " + testAdminToken, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		n.adminToken = c.adminToken
+
+		req := httptest.NewRequest(http.MethodGet, endpointAdminPeers, nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.status {
+			t.Fatalf("token '%s' with auth '%s' should be answered %d, got %d", c.adminToken, c.auth, c.status, rec.Code)
+		}
+	}
+}
+
+func TestAdminPeersHandler(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	account := database.NewAccount(testKsSimoneAccount)
+
+	res := AdminPeersRes{}
+	sendTestAdminReq(t, n, adminPeersHandler, http.MethodPost, endpointAdminPeers,
+		AdminPeerAddReq{IP: "127.0.0.1", Port: 8086, Account: account}, http.StatusOK, &res)
+
+	if len(res.Known) != 1 || res.Known[0].Account != account || res.Known[0].Connected {
+		t.Fatalf("added peer should be known and not yet connected, got %+v", res.Known)
+	}
+
+	knownPeers, err := LoadKnownPeers(n.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isKnownPeer := knownPeers["127.0.0.1:8086"]; !isKnownPeer {
+		t.Fatal("added peer should be persisted in the data dir")
+	}
+
+	sendTestAdminReq(t, n, adminPeersHandler, http.MethodPost, endpointAdminPeers,
+		AdminPeerAddReq{IP: "127.0.0.1", Port: 8085}, http.StatusBadRequest, nil)
+
+	sendTestAdminReq(t, n, adminPeersHandler, http.MethodDelete, endpointAdminPeers+"?ip=127.0.0.1&port=8087",
+		nil, http.StatusNotFound, nil)
+
+	sendTestAdminReq(t, n, adminPeersHandler, http.MethodDelete, endpointAdminPeers+"?ip=127.0.0.1&port=8086&ban=true",
+		nil, http.StatusOK, &res)
+
+	if len(res.Known) != 0 || len(res.Banned) != 1 || res.Banned[0].Reason != adminBanReason {
+		t.Fatalf("removed peer should be banned, got %+v", res)
+	}
+
+	sendTestAdminReq(t, n, adminPeersHandler, http.MethodPost, endpointAdminPeers,
+		AdminPeerAddReq{IP: "127.0.0.1", Port: 8086}, http.StatusOK, &res)
+
+	if len(res.Known) != 1 || len(res.Banned) != 0 {
+		t.Fatalf("adding a banned peer should lift its ban, got %+v", res)
+	}
+
+	sendTestAdminReq(t, n, adminPeersHandler, http.MethodPut, endpointAdminPeers,
+		nil, http.StatusMethodNotAllowed, nil)
+}
+
+func TestAdminMiningAndMempoolHandlers(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	miner := database.NewAccount(testKsSimoneAccount)
+
+	res := AdminMiningRes{}
+	sendTestAdminReq(t, n, adminMiningHandler, http.MethodPost, endpointAdminMining,
+		AdminMiningReq{Enabled: false}, http.StatusOK, &res)
+
+	if res.Enabled || n.isMiningEnabled() {
+		t.Fatal("mining should be paused")
+	}
+
+	select {
+	case <-n.miningAbandoned:
+	default:
+		t.Fatal("pausing should abandon the block being mined")
+	}
+
+	sendTestAdminReq(t, n, adminMinerHandler, http.MethodPost, endpointAdminMiner,
+		AdminMinerReq{Miner: miner}, http.StatusOK, &res)
+
+	if res.Miner != miner || n.minerAccount() != miner {
+		t.Fatalf("miner should be changed, got %s", res.Miner.String())
+	}
+
+	n.pendingTXs["0x01"] = database.SignedTx{}
+	n.pendingTXs["0x02"] = database.SignedTx{}
+
+	flushRes := AdminMempoolFlushRes{}
+	sendTestAdminReq(t, n, adminMempoolFlushHandler, http.MethodPost, endpointAdminMempoolFlush,
+		nil, http.StatusOK, &flushRes)
+
+	if flushRes.Flushed != 2 || len(n.pendingTXs) != 0 {
+		t.Fatalf("every pending TX should be dropped, got %d", flushRes.Flushed)
+	}
+}
+
+// Run with -race: the admin requests race the sync and the miner.
+func TestAdminHandlersConcurrentWithSyncAndMiner(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	peer := NewPeerNode("127.0.0.1", 8086, false, common.Address{}, false)
+
+	var workers sync.WaitGroup
+	workers.Add(3)
+
+	go func() {
+		defer workers.Done()
+		for i := 0; i < 50; i++ {
+			if err := n.adminAddPeer(peer); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := n.adminRemovePeer(peer, true); err != nil {
+				t.Error(err)
+				return
+			}
+			n.adminPeers()
+			n.dropPendingTXs()
+		}
+	}()
+
+	go func() {
+		defer workers.Done()
+		for i := 0; i < 50; i++ {
+			n.penalizePeer(peer, fmt.Errorf("timeout"))
+			n.rewardPeer(peer)
+			n.IsBannedPeer(peer)
+			for range n.knownPeersCopy() {
+			}
+		}
+	}()
+
+	go func() {
+		defer workers.Done()
+		for i := 0; i < 50; i++ {
+			tx := database.NewSignedTx(database.NewTx(common.Address{}, common.Address{}, uint(i), ""), nil)
+			n.mempoolMu.Lock()
+			n.pendingTXs[fmt.Sprint(i)] = tx
+			n.mempoolMu.Unlock()
+
+			n.removeMinedPendingTXs(database.Block{TXs: n.getPendingTXsAsArray()})
+		}
+	}()
+
+	workers.Wait()
+}
+
+func sendTestAdminReq(
+	t *testing.T,
+	n *Node,
+	handler func(http.ResponseWriter, *http.Request, *Node),
+	method string,
+	target string,
+	reqBody interface{},
+	status int,
+	res interface{}) {
+	body := []byte{}
+	if reqBody != nil {
+		reqJson, err := json.Marshal(reqBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = reqJson
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, target, bytes.NewReader(body)), n)
+
+	if rec.Code != status {
+		t.Fatalf("%s %s should be answered %d, got %d: %s", method, target, status, rec.Code, rec.Body.String())
+	}
+
+	if res != nil {
+		err := json.Unmarshal(rec.Body.Bytes(), res)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
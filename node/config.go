@@ -0,0 +1,77 @@
+package node
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const DefaultMiningInterval = 10 * time.Second
+const DefaultSyncInterval = 45 * time.Second
+
+// DefaultShutdownTimeout is how long the in-flight HTTP requests get to
+// complete once the node is stopping.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Config gathers the settings of a Node.
+type Config struct {
+	DataDir         string
+	IP              string
+	Port            uint64
+	Miner           common.Address
+	Bootstraps      []PeerNode
+	PeerBanDuration time.Duration
+	TLS             TLSConfig
+	// AcceptPeers lets unknown Peers join through the /node/peer endpoint,
+	// otherwise only the bootstraps and the admin added Peers can
+	AcceptPeers bool
+	// AdminToken authenticates the /admin/* requests, disabled if empty
+	AdminToken string
+
+	// MiningInterval is how often the pending TXs are checked for mining
+	MiningInterval time.Duration
+	// MiningThreads is how many goroutines mine a block, GOMAXPROCS if 0
+	MiningThreads int
+	// SyncInterval is how often the node syncs with its peers
+	SyncInterval         time.Duration
+	ReadyMaxBlocksBehind uint64
+	ShutdownTimeout      time.Duration
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	MaxBodyBytes int64
+	// RateLimit caps the requests of each client IP per route, unless the
+	// route has its own limit in RouteRateLimits
+	RateLimit       RateLimit
+	RouteRateLimits map[string]RateLimit
+	CORS            CORSConfig
+
+	// Webhooks receive the committed chain Events
+	Webhooks []Webhook
+}
+
+// DefaultConfig configures a node storing its data in `dataDir` and
+// without any bootstrap peer.
+func DefaultConfig(dataDir string) Config {
+	return Config{
+		DataDir:              dataDir,
+		IP:                   DefaultIP,
+		Port:                 DefaultHTTPort,
+		Miner:                database.NewAccount(DefaultMiner),
+		Bootstraps:           []PeerNode{},
+		PeerBanDuration:      DefaultPeerBanDuration,
+		AcceptPeers:          true,
+		MiningInterval:       DefaultMiningInterval,
+		SyncInterval:         DefaultSyncInterval,
+		ReadyMaxBlocksBehind: DefaultReadyMaxBlocksBehind,
+		ShutdownTimeout:      DefaultShutdownTimeout,
+		ReadTimeout:          DefaultReadTimeout,
+		WriteTimeout:         DefaultWriteTimeout,
+		MaxBodyBytes:         DefaultMaxBodyBytes,
+		RateLimit:            DefaultRateLimit,
+		RouteRateLimits:      DefaultRouteRateLimits(),
+		CORS:                 DefaultCORSConfig(),
+		Webhooks:             []Webhook{},
+	}
+}
@@ -0,0 +1,112 @@
+package node
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/cors"
+)
+
+const DefaultCORSMaxAge = 10 * time.Minute
+
+// corsExcludedPrefixes are never exposed to browsers: the peer endpoints
+// are only called by nodes, and the admin ones must not be driven by a
+// web page.
+var corsExcludedPrefixes = []string{"/node/", endpointAdmin}
+
+// CORSConfig lets the browser pages served from AllowedOrigins call the
+// public endpoints. CORS is disabled without AllowedOrigins.
+//
+// An origin is either `*`, allowing any, or a scheme and host that may
+// contain one `*` wildcard, e.g. https://*.example.com.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         DefaultCORSMaxAge,
+	}
+}
+
+func (c CORSConfig) isOriginAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, allowed := range c.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		wildcard := strings.Index(allowed, "*")
+		if wildcard == -1 {
+			continue
+		}
+
+		prefix, suffix := allowed[:wildcard], allowed[wildcard+1:]
+		if len(origin) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) &&
+			strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withCORS answers the preflight requests and adds the CORS headers to the
+// responses of the public endpoints.
+func withCORS(cfg CORSConfig, next http.Handler) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return next
+	}
+
+	corsHandler := cors.New(cors.Options{
+		AllowOriginFunc: cfg.isOriginAllowed,
+		AllowedMethods:  cfg.AllowedMethods,
+		AllowedHeaders:  cfg.AllowedHeaders,
+		// Lets the rate limited browser pages know when to retry
+		ExposedHeaders: []string{"Retry-After"},
+		MaxAge:         int(cfg.MaxAge.Seconds()),
+	}).Handler(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range corsExcludedPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		corsHandler.ServeHTTP(w, r)
+	})
+}
+
+// checkWsOrigin accepts the WebSocket upgrades from pages of the node
+// itself or of the CORS allowed origins.
+func (n *Node) checkWsOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	originUrl, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(originUrl.Host, r.Host) {
+		return true
+	}
+
+	return n.cors.isOriginAllowed(origin)
+}
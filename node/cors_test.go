@@ -0,0 +1,104 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSConfig_IsOriginAllowed(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://wallet.example.com", "https://*.sb.dev"}}
+
+	cases := map[string]bool{
+		"https://wallet.example.com": true,
+		"https://WALLET.example.com": true,
+		"http://wallet.example.com":  false,
+		"https://app.sb.dev":         true,
+		"https://sb.dev":             false,
+		"https://evil.com":           false,
+	}
+
+	for origin, isAllowed := range cases {
+		if cfg.isOriginAllowed(origin) != isAllowed {
+			t.Fatalf("origin '%s' allowed should be %t", origin, isAllowed)
+		}
+	}
+
+	if !(CORSConfig{AllowedOrigins: []string{"*"}}).isOriginAllowed("https://evil.com") {
+		t.Fatal("* should allow any origin")
+	}
+}
+
+func TestWithCORS(t *testing.T) {
+	cfg := DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://wallet.example.com"}
+
+	handler := withCORS(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMethodAllowed(w, r, http.MethodGet) {
+			return
+		}
+
+		writeRes(w, HealthRes{})
+	}))
+
+	cases := []struct {
+		path        string
+		origin      string
+		status      int
+		allowOrigin string
+	}{
+		{"/balances/list", "https://wallet.example.com", http.StatusOK, "https://wallet.example.com"},
+		{"/balances/list", "https://evil.com", http.StatusOK, ""},
+		{endpointStatus, "https://wallet.example.com", http.StatusMethodNotAllowed, ""},
+		{endpointAdminPeers, "https://wallet.example.com", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodOptions, c.path, nil)
+		req.Header.Set("Origin", c.origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.status || rec.Header().Get("Access-Control-Allow-Origin") != c.allowOrigin {
+			t.Fatalf(
+				"preflight of %s from %s should be answered %d allowing '%s', got %d allowing '%s'",
+				c.path, c.origin, c.status, c.allowOrigin, rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/balances/list", nil)
+	req.Header.Set("Origin", "https://wallet.example.com")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://wallet.example.com" ||
+		rec.Header().Get("Access-Control-Expose-Headers") != "Retry-After" {
+		t.Fatalf("response to an allowed origin should carry the CORS headers, got %v", rec.Header())
+	}
+}
+
+func TestNode_CheckWsOrigin(t *testing.T) {
+	n := &Node{cors: CORSConfig{AllowedOrigins: []string{"https://wallet.example.com"}}}
+
+	cases := map[string]bool{
+		"":                           true,
+		"http://localhost:8080":      true,
+		"https://wallet.example.com": true,
+		"https://evil.com":           false,
+	}
+
+	for origin, isAllowed := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+endpointWS, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		if n.checkWsOrigin(req) != isAllowed {
+			t.Fatalf("WebSocket from origin '%s' allowed should be %t", origin, isAllowed)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package node
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const EventNewBlock = "newBlocks"
+const EventPendingTx = "pendingTxs"
+const EventBalance = "balances"
+
+// An Event relates to the accounts it credits, i.e. receiving funds, and
+// to the accounts it debits, i.e. spending funds.
+const EventDirectionIn = "in"
+const EventDirectionOut = "out"
+
+// Event is pushed to the subscribers of its Topic.
+type Event struct {
+	Topic string      `json:"topic"`
+	Data  interface{} `json:"data"`
+
+	// accounts the Event relates to, used to filter the subscriptions, as
+	// well as the ones it credits and debits
+	accounts []common.Address
+	credited []common.Address
+	debited  []common.Address
+}
+
+// relatesTo tells whether the Event relates to a `watched` account in the
+// `direction`, in any direction if empty.
+func (e Event) relatesTo(watched map[common.Address]bool, direction string) bool {
+	accounts := e.accounts
+	switch direction {
+	case EventDirectionIn:
+		accounts = e.credited
+	case EventDirectionOut:
+		accounts = e.debited
+	}
+
+	for _, account := range accounts {
+		if watched[account] {
+			return true
+		}
+	}
+
+	return false
+}
+
+type BalanceChangeRes struct {
+	Account     common.Address `json:"account"`
+	Balance     uint           `json:"balance"`
+	BlockHash   database.Hash  `json:"block_hash"`
+	BlockNumber uint64         `json:"block_number"`
+}
+
+// addBlock commits the `block` to the state and notifies the subscribers.
+func (n *Node) addBlock(block database.Block) error {
+	start := time.Now()
+
+	blockHash, err := n.state.AddBlock(block)
+	if err != nil {
+		return err
+	}
+
+	n.metrics.blockApply.UpdateSince(start)
+
+	n.publishBlock(database.BlockFS{Key: blockHash, Value: block})
+
+	return nil
+}
+
+func (n *Node) publishBlock(blockFs database.BlockFS) {
+	blockRes, err := newBlockRes(blockFs)
+	if err != nil {
+		n.logger.Error("Unable to publish block", "hash", blockFs.Key.Hex(), "err", err)
+		return
+	}
+
+	accounts := blockAccounts(blockFs.Value)
+	credited, debited := blockTransfers(blockFs.Value)
+
+	n.publish(Event{
+		Topic:    EventNewBlock,
+		Data:     blockRes,
+		accounts: accounts,
+		credited: credited,
+		debited:  debited,
+	})
+
+	for _, account := range accounts {
+		balanceEvent := Event{
+			Topic: EventBalance,
+			Data: BalanceChangeRes{
+				account,
+				n.state.Balance(account),
+				blockFs.Key,
+				blockFs.Value.Header.Number,
+			},
+			accounts: []common.Address{account},
+		}
+
+		if containsAccount(credited, account) {
+			balanceEvent.credited = balanceEvent.accounts
+		}
+		if containsAccount(debited, account) {
+			balanceEvent.debited = balanceEvent.accounts
+		}
+
+		n.publish(balanceEvent)
+	}
+}
+
+func (n *Node) publishPendingTX(txHash database.Hash, tx database.SignedTx) {
+	n.publish(Event{
+		Topic:    EventPendingTx,
+		Data:     BlockTxRes{txHash, tx},
+		accounts: []common.Address{tx.From, tx.To},
+		credited: []common.Address{tx.To},
+		debited:  []common.Address{tx.From},
+	})
+}
+
+// publish pushes the `event` to the WebSocket subscribers, and to the
+// webhooks when committed to the chain.
+func (n *Node) publish(event Event) {
+	n.wsHub.publish(event)
+
+	if event.Topic != EventPendingTx {
+		n.webhooks.publish(event)
+	}
+}
+
+// blockAccounts lists, without duplicates, the accounts whose balance
+// the `block` changed.
+func blockAccounts(block database.Block) []common.Address {
+	accounts := []common.Address{block.Header.Miner}
+	seen := map[common.Address]bool{block.Header.Miner: true}
+
+	for _, tx := range block.TXs {
+		for _, account := range []common.Address{tx.From, tx.To} {
+			if !seen[account] {
+				seen[account] = true
+				accounts = append(accounts, account)
+			}
+		}
+	}
+
+	return accounts
+}
+
+// blockTransfers lists, without duplicates, the accounts the `block`
+// credits, its miner and TX receivers, and the ones it debits, its TX
+// senders.
+func blockTransfers(block database.Block) (credited []common.Address, debited []common.Address) {
+	credited = []common.Address{block.Header.Miner}
+	debited = make([]common.Address, 0)
+
+	for _, tx := range block.TXs {
+		if !containsAccount(credited, tx.To) {
+			credited = append(credited, tx.To)
+		}
+		if !containsAccount(debited, tx.From) {
+			debited = append(debited, tx.From)
+		}
+	}
+
+	return credited, debited
+}
+
+func containsAccount(accounts []common.Address, account common.Address) bool {
+	for _, a := range accounts {
+		if a == account {
+			return true
+		}
+	}
+
+	return false
+}
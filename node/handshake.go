@@ -0,0 +1,139 @@
+package node
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+// A joining node proves its identity by signing a single use challenge
+// issued by the Peer, and the Peer does the same with a challenge issued
+// by the joining node:
+//
+//  1. A -> B /node/handshake?challenge=cA&ip=A.ip&port=A.port
+//     B answers with its account, cB and its signature of (cA, A.ip:A.port)
+//  2. A -> B /node/peer?ip=A.ip&port=A.port&account=A.acc&challenge=cB&sig=...
+//     A sends its signature of (cB, A.ip:A.port)
+//  3. B -> A.ip:A.port /node/handshake?challenge=cB2&ip=B.ip&port=B.port
+//     B dials A back and checks the node answering is A.acc, proving A
+//     serves the address it registers
+//
+// Both signatures cover the joining node address so they can't be replayed
+// to register a different one.
+const handshakeChallengeTTL = time.Minute
+const handshakeChallengeLength = 32
+
+// maxHandshakeChallenges caps the challenges waiting to be answered, the
+// handshake is refused until some are used or expire.
+const maxHandshakeChallenges = 1024
+
+func newHandshakeChallenge() (string, error) {
+	challenge := make([]byte, handshakeChallengeLength)
+
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(challenge), nil
+}
+
+func handshakeMsg(challenge string, joiningTcpAddress string) []byte {
+	return []byte(fmt.Sprintf("sb-handshake:%s:%s", challenge, joiningTcpAddress))
+}
+
+func (n *Node) issueHandshakeChallenge() (string, error) {
+	challenge, err := newHandshakeChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	n.handshakeMu.Lock()
+	defer n.handshakeMu.Unlock()
+
+	for issued, expiresAt := range n.handshakeChallenges {
+		if time.Now().After(expiresAt) {
+			delete(n.handshakeChallenges, issued)
+		}
+	}
+
+	if len(n.handshakeChallenges) >= maxHandshakeChallenges {
+		return "", statusErr{
+			http.StatusServiceUnavailable, fmt.Errorf("too many handshakes in progress, retry later")}
+	}
+
+	n.handshakeChallenges[challenge] = time.Now().Add(handshakeChallengeTTL)
+
+	return challenge, nil
+}
+
+// consumeHandshakeChallenge returns whether the challenge was issued by
+// this node and not used nor expired yet.
+func (n *Node) consumeHandshakeChallenge(challenge string) bool {
+	n.handshakeMu.Lock()
+	defer n.handshakeMu.Unlock()
+
+	expiresAt, isIssued := n.handshakeChallenges[challenge]
+	if !isIssued {
+		return false
+	}
+
+	delete(n.handshakeChallenges, challenge)
+
+	return time.Now().Before(expiresAt)
+}
+
+func (n *Node) signHandshake(
+	challenge string, joiningTcpAddress string) ([]byte, error) {
+	return wallet.Sign(handshakeMsg(challenge, joiningTcpAddress), n.nodeKey)
+}
+
+func verifyHandshake(
+	challenge string,
+	joiningTcpAddress string,
+	sig []byte,
+	account common.Address) error {
+	pubKey, err := wallet.Verify(handshakeMsg(challenge, joiningTcpAddress), sig)
+	if err != nil {
+		return err
+	}
+
+	signer := crypto.PubkeyToAddress(*pubKey)
+	if signer != account {
+		return fmt.Errorf(
+			"handshake was signed by '%s' instead of '%s'",
+			signer.String(),
+			account.String())
+	}
+
+	return nil
+}
+
+// verifyPeerAddress dials the joining `peer` back at the address it claims
+// and checks the node answering there holds the `peer` account key.
+func (n *Node) verifyPeerAddress(ctx context.Context, peer PeerNode) error {
+	challenge, err := newHandshakeChallenge()
+	if err != nil {
+		return err
+	}
+
+	handshakeRes, err := peer.apiClient(n.peerClient).Handshake(
+		ctx, challenge, n.info.IP, n.info.Port)
+	if err != nil {
+		return fmt.Errorf("unable to reach '%s' back. %s", peer.TcpAddress(), err.Error())
+	}
+
+	err = verifyHandshake(challenge, n.info.TcpAddress(), handshakeRes.Sig, peer.Account)
+	if err != nil {
+		return fmt.Errorf("'%s' is not served by the joining node. %s", peer.TcpAddress(), err.Error())
+	}
+
+	return nil
+}
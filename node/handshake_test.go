@@ -0,0 +1,208 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+)
+
+func TestNode_JoinKnownPeersWithSignedHandshake(t *testing.T) {
+	peerNode, peer := startTestHandshakePeer(t)
+	n := newTestHandshakeNode(t, []PeerNode{peer})
+	serveTestHandshakeNode(t, n)
+
+	err := n.joinKnownPeers(context.Background(), peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joinedPeer := n.knownPeers[peer.TcpAddress()]
+	if !joinedPeer.connected {
+		t.Fatal("peer should be connected after the handshake")
+	}
+
+	if joinedPeer.Account != peerNode.info.Account {
+		t.Fatal("peer account should be the one proven by the handshake")
+	}
+
+	registeredNode, isKnownPeer := peerNode.knownPeers[n.info.TcpAddress()]
+	if !isKnownPeer || registeredNode.Account != n.info.Account || !registeredNode.connected {
+		t.Fatal("peer should have registered the node with its verified account")
+	}
+}
+
+func TestNode_JoinKnownPeersRejectsAddressServedByAnotherNode(t *testing.T) {
+	peerNode, peer := startTestHandshakePeer(t)
+	victimNode, victim := startTestHandshakePeer(t)
+
+	// The node signs the handshake with its own key for the victim address
+	n := newTestHandshakeNode(t, []PeerNode{peer})
+	n.info.IP = victim.IP
+	n.info.Port = victim.Port
+
+	err := n.joinKnownPeers(context.Background(), peer)
+	if err == nil {
+		t.Fatal("node not serving the address it claims should be refused")
+	}
+
+	if _, isKnownPeer := peerNode.knownPeers[victim.TcpAddress()]; isKnownPeer {
+		t.Fatalf("'%s' should not be registered under '%s'", victim.TcpAddress(), victimNode.info.Account.String())
+	}
+
+	// Nobody listens at the claimed address
+	n.info.Port = 1
+
+	err = n.joinKnownPeers(context.Background(), peer)
+	if err == nil {
+		t.Fatal("node unreachable at the address it claims should be refused")
+	}
+}
+
+func TestNode_JoinKnownPeersRejectsImpersonatedPeer(t *testing.T) {
+	_, peer := startTestHandshakePeer(t)
+	peer.Account = database.NewAccount(testKsSimoneAccount)
+
+	n := newTestHandshakeNode(t, []PeerNode{peer})
+
+	err := n.joinKnownPeers(context.Background(), peer)
+	if err == nil {
+		t.Fatal("peer not owning the configured account should be rejected")
+	}
+
+	if penaltyFor(err) != peerPenaltyInvalidHandshake {
+		t.Fatal("impersonating peer should be penalized")
+	}
+}
+
+func TestNode_JoinKnownPeersRefusedUnlessAddedByAdmin(t *testing.T) {
+	peerNode, peer := startTestHandshakePeer(t)
+	peerNode.acceptPeers = false
+
+	n := newTestHandshakeNode(t, []PeerNode{peer})
+	serveTestHandshakeNode(t, n)
+
+	err := n.joinKnownPeers(context.Background(), peer)
+	if err == nil {
+		t.Fatal("peer not accepting new peers should refuse the node")
+	}
+
+	err = peerNode.adminAddPeer(n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.joinKnownPeers(context.Background(), peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNode_HandshakeChallengeAndSignature(t *testing.T) {
+	peerNode, peer := startTestHandshakePeer(t)
+	n := newTestHandshakeNode(t, []PeerNode{peer})
+
+	challenge, err := peerNode.issueHandshakeChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := n.signHandshake(challenge, n.info.TcpAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature is valid for another account
+	err = verifyHandshake(
+		challenge, n.info.TcpAddress(), sig, database.NewAccount(testKsSimoneAccount))
+	if err == nil {
+		t.Fatal("handshake signed by another account should be invalid")
+	}
+
+	if !peerNode.consumeHandshakeChallenge(challenge) {
+		t.Fatal("issued challenge should be valid")
+	}
+
+	if peerNode.consumeHandshakeChallenge(challenge) {
+		t.Fatal("challenge should be valid only once")
+	}
+}
+
+func TestNode_HandshakeChallengesAreCapped(t *testing.T) {
+	n := newTestHandshakeNode(t, []PeerNode{})
+
+	for i := 0; i < maxHandshakeChallenges; i++ {
+		_, err := n.issueHandshakeChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := n.issueHandshakeChallenge()
+	if err == nil {
+		t.Fatal("challenges over the cap should be refused")
+	}
+
+	for challenge := range n.handshakeChallenges {
+		n.handshakeChallenges[challenge] = time.Now().Add(-time.Second)
+		break
+	}
+
+	_, err = n.issueHandshakeChallenge()
+	if err != nil {
+		t.Fatalf("expired challenges should make room for new ones, got %s", err)
+	}
+}
+
+func newTestHandshakeNode(t *testing.T, bootstraps []PeerNode) *Node {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.RemoveDir(dataDir) })
+
+	nodeKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := New(newTestConfig(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), bootstraps), logger.Discard())
+	n.nodeKey = nodeKey
+	n.info.Account = crypto.PubkeyToAddress(nodeKey.PublicKey)
+
+	return n
+}
+
+// startTestHandshakePeer serves the handshake endpoints of a new node.
+func startTestHandshakePeer(t *testing.T) (*Node, PeerNode) {
+	peerNode := newTestHandshakeNode(t, []PeerNode{})
+
+	peer := serveTestHandshakeNode(t, peerNode)
+	peer.IsBootstrap = true
+	peer.connected = false
+
+	return peerNode, peer
+}
+
+// serveTestHandshakeNode serves the handshake endpoints of the `n` node,
+// advertising the address it listens at.
+func serveTestHandshakeNode(t *testing.T, n *Node) PeerNode {
+	handler := http.NewServeMux()
+	handler.HandleFunc(endpointHandshake, func(w http.ResponseWriter, r *http.Request) {
+		handshakeHandler(w, r, n)
+	})
+	handler.HandleFunc(endpointAddPeer, func(w http.ResponseWriter, r *http.Request) {
+		addPeerHandler(w, r, n)
+	})
+
+	peer := startTestPeerServer(t, handler)
+	n.info.IP = peer.IP
+	n.info.Port = peer.Port
+
+	return peer
+}
@@ -0,0 +1,174 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const endpointHealthz = "/healthz"
+const endpointReadyz = "/readyz"
+
+// DefaultReadyMaxBlocksBehind is how many blocks a node may lag behind the
+// best peer and still be ready to serve.
+const DefaultReadyMaxBlocksBehind = 2
+
+type HealthRes struct {
+	Status string `json:"status"`
+}
+
+type ReadinessRes struct {
+	Ready          bool     `json:"ready"`
+	Height         uint64   `json:"height"`
+	BestPeerHeight uint64   `json:"best_peer_height"`
+	LastSync       string   `json:"last_sync,omitempty"`
+	Reasons        []string `json:"reasons"`
+}
+
+// syncProgress remembers the outcome of the last doSync for the readiness
+// probe, served concurrently with the sync.
+type syncProgress struct {
+	mu           sync.Mutex
+	lastSync     time.Time
+	queriedPeers int
+	activePeers  int
+
+	// peerHeights are the last heights claimed by the peers with blocks,
+	// kept while they are unreachable
+	peerHeights map[string]uint64
+}
+
+// record stores the heights claimed by the peers which answered the last
+// doSync out of the `queriedPeers`, forgetting the peers no longer known.
+func (sp *syncProgress) record(
+	statuses map[string]StatusRes, queriedPeers int, knownPeers map[string]PeerNode) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.peerHeights == nil {
+		sp.peerHeights = make(map[string]uint64)
+	}
+
+	sp.lastSync = time.Now()
+	sp.queriedPeers = queriedPeers
+	sp.activePeers = len(statuses)
+
+	for tcpAddress, status := range statuses {
+		if status.Hash.IsEmpty() {
+			delete(sp.peerHeights, tcpAddress)
+			continue
+		}
+
+		sp.peerHeights[tcpAddress] = status.Number
+	}
+
+	for tcpAddress := range sp.peerHeights {
+		if _, isKnownPeer := knownPeers[tcpAddress]; !isKnownPeer {
+			delete(sp.peerHeights, tcpAddress)
+		}
+	}
+}
+
+// forget drops the height claimed by the Peer at `tcpAddress`.
+func (sp *syncProgress) forget(tcpAddress string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	delete(sp.peerHeights, tcpAddress)
+}
+
+type syncProgressSnapshot struct {
+	lastSync       time.Time
+	queriedPeers   int
+	activePeers    int
+	bestPeerHeight uint64
+	hasBestPeer    bool
+}
+
+func (sp *syncProgress) snapshot() syncProgressSnapshot {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	snapshot := syncProgressSnapshot{
+		lastSync:     sp.lastSync,
+		queriedPeers: sp.queriedPeers,
+		activePeers:  sp.activePeers,
+	}
+
+	for _, height := range sp.peerHeights {
+		if !snapshot.hasBestPeer || height > snapshot.bestPeerHeight {
+			snapshot.bestPeerHeight = height
+			snapshot.hasBestPeer = true
+		}
+	}
+
+	return snapshot
+}
+
+// readiness reports whether the node loaded its state, completed a sync
+// reaching at least one of its peers and is within readyMaxBlocksBehind
+// blocks of the best peer. A node without any peer to sync with is alone
+// on its chain.
+func (n *Node) readiness() ReadinessRes {
+	progress := n.syncProgress.snapshot()
+	lastSync := progress.lastSync
+	bestPeerHeight := progress.bestPeerHeight
+
+	res := ReadinessRes{BestPeerHeight: bestPeerHeight, Reasons: []string{}}
+
+	if n.state == nil {
+		res.Reasons = append(res.Reasons, "state is not loaded")
+	} else {
+		res.Height = n.state.LatestBlock().Header.Number
+	}
+
+	if lastSync.IsZero() {
+		res.Reasons = append(res.Reasons, "waiting for the first sync with peers")
+	} else {
+		res.LastSync = lastSync.UTC().Format(time.RFC3339)
+	}
+
+	if progress.queriedPeers > 0 && progress.activePeers == 0 {
+		res.Reasons = append(res.Reasons, fmt.Sprintf(
+			"none of the %d peers answered the last sync", progress.queriedPeers))
+	}
+
+	if n.state != nil && progress.hasBestPeer {
+		// An empty chain hasn't even imported the genesis block 0 yet
+		missingBlocks := bestPeerHeight + 1
+		if !n.state.LatestBlockHash().IsEmpty() {
+			missingBlocks = bestPeerHeight - res.Height
+			if bestPeerHeight < res.Height {
+				missingBlocks = 0
+			}
+		}
+
+		if missingBlocks > n.readyMaxBlocksBehind {
+			res.Reasons = append(res.Reasons, fmt.Sprintf(
+				"%d blocks behind the best peer, at most %d allowed",
+				missingBlocks,
+				n.readyMaxBlocksBehind))
+		}
+	}
+
+	res.Ready = len(res.Reasons) == 0
+
+	return res
+}
+
+// healthzHandler answers as long as the node serves HTTP requests.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeRes(w, HealthRes{Status: "ok"})
+}
+
+// readyzHandler answers 503 with the reasons while the node isn't ready.
+func readyzHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	res := node.readiness()
+	if !res.Ready {
+		writeResWithStatus(w, res, http.StatusServiceUnavailable)
+		return
+	}
+
+	writeRes(w, res)
+}
@@ -0,0 +1,96 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest(http.MethodGet, endpointHealthz, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("a serving node should be alive, got %d", rec.Code)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+
+	res, status := getTestReadiness(t, n)
+	if status != http.StatusServiceUnavailable || !hasReason(res, "first sync") {
+		t.Fatalf("node never synced should not be ready, got %d %v", status, res.Reasons)
+	}
+
+	aheadPeer := StatusRes{Hash: database.Hash{1}, Number: 5}
+	emptyPeer := StatusRes{}
+	knownPeers := map[string]PeerNode{"127.0.0.1:8086": {}, "127.0.0.1:8087": {}}
+	n.syncProgress.record(map[string]StatusRes{"127.0.0.1:8086": aheadPeer, "127.0.0.1:8087": emptyPeer}, 2, knownPeers)
+
+	res, status = getTestReadiness(t, n)
+	if status != http.StatusServiceUnavailable || !hasReason(res, "6 blocks behind") {
+		t.Fatalf("node lagging behind the best peer should not be ready, got %d %v", status, res.Reasons)
+	}
+	if res.BestPeerHeight != 5 || res.LastSync == "" {
+		t.Fatalf("readiness should report the last sync, got %+v", res)
+	}
+
+	// The ahead peer is unreachable
+	n.syncProgress.record(map[string]StatusRes{"127.0.0.1:8087": emptyPeer}, 2, knownPeers)
+
+	res, status = getTestReadiness(t, n)
+	if status != http.StatusServiceUnavailable || res.BestPeerHeight != 5 {
+		t.Fatalf("height of an unreachable peer should be kept, got %d %+v", status, res)
+	}
+
+	n.syncProgress.record(map[string]StatusRes{}, 2, knownPeers)
+
+	res, status = getTestReadiness(t, n)
+	if status != http.StatusServiceUnavailable || !hasReason(res, "none of the 2 peers answered") {
+		t.Fatalf("node reaching none of its peers should not be ready, got %d %v", status, res.Reasons)
+	}
+
+	delete(knownPeers, "127.0.0.1:8086")
+	n.syncProgress.record(map[string]StatusRes{"127.0.0.1:8087": emptyPeer}, 1, knownPeers)
+
+	res, status = getTestReadiness(t, n)
+	if status != http.StatusOK || !res.Ready || len(res.Reasons) != 0 {
+		t.Fatalf("node synced with its peers should be ready, got %d %v", status, res.Reasons)
+	}
+
+	n.syncProgress.record(map[string]StatusRes{}, 0, map[string]PeerNode{})
+
+	res, status = getTestReadiness(t, n)
+	if status != http.StatusOK {
+		t.Fatalf("node without peers should be ready, got %d %v", status, res.Reasons)
+	}
+}
+
+func getTestReadiness(t *testing.T, n *Node) (ReadinessRes, int) {
+	rec := httptest.NewRecorder()
+	readyzHandler(rec, httptest.NewRequest(http.MethodGet, endpointReadyz, nil), n)
+
+	var res ReadinessRes
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res, rec.Code
+}
+
+func hasReason(res ReadinessRes, reason string) bool {
+	for _, r := range res.Reasons {
+		if strings.Contains(r, reason) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,19 +2,55 @@ package node
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
+// statusErr is a failure caused by the client request, answered with the
+// 4xx `status` rather than 500.
+type statusErr struct {
+	status int
+	err    error
+}
+
+func (e statusErr) Error() string {
+	return e.err.Error()
+}
+
+func (e statusErr) Unwrap() error {
+	return e.err
+}
+
+func newBadReqErr(err error) error {
+	return statusErr{http.StatusBadRequest, err}
+}
+
 func writeErrRes(w http.ResponseWriter, err error) {
-	jsonErrRes, _ := json.Marshal(ErrRes{err.Error()})
+	status := http.StatusInternalServerError
+
+	var reqErr statusErr
+	if errors.As(err, &reqErr) {
+		status = reqErr.status
+	}
+
+	writeErrResWithStatus(w, err, status)
+}
+
+func writeErrResWithStatus(w http.ResponseWriter, err error, status int) {
+	jsonErrRes, _ := json.Marshal(ErrRes{Error: err.Error()})
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
+	w.WriteHeader(status)
 	w.Write(jsonErrRes)
 }
 
 func writeRes(w http.ResponseWriter, content interface{}) {
+	writeResWithStatus(w, content, http.StatusOK)
+}
+
+func writeResWithStatus(w http.ResponseWriter, content interface{}, status int) {
 	contentJson, err := json.Marshal(content)
 	if err != nil {
 		writeErrRes(w, err)
@@ -22,35 +58,46 @@ func writeRes(w http.ResponseWriter, content interface{}) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	w.Write(contentJson)
 }
 
-func readReq(r *http.Request, reqBody interface{}) error {
-	reqBodyJson, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return fmt.Errorf("unable to read request body. %s", err.Error())
+// isMethodAllowed answers 405 to requests of another method than `methods`.
+func isMethodAllowed(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
 	}
-	defer r.Body.Close()
 
-	err = json.Unmarshal(reqBodyJson, reqBody)
-	if err != nil {
-		return fmt.Errorf("unable to unmarshal request body. %s", err.Error())
-	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeErrResWithStatus(
+		w, fmt.Errorf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
 
-	return nil
+	return false
 }
 
-func readRes(r *http.Response, reqBody interface{}) error {
+// readReq validates the request body against the OpenAPI schema of the
+// `reqBody` type before decoding it. An invalid body is a bad request.
+func readReq(r *http.Request, reqBody interface{}) error {
 	reqBodyJson, err := ioutil.ReadAll(r.Body)
+	if errors.Is(err, errReqBodyTooLarge) {
+		return statusErr{http.StatusRequestEntityTooLarge, err}
+	}
 	if err != nil {
-		return fmt.Errorf("unable to read response body. %s", err.Error())
+		return fmt.Errorf("unable to read request body. %s", err.Error())
 	}
 	defer r.Body.Close()
 
+	err = validateReq(reqBodyJson, reqBody)
+	if err != nil {
+		return newBadReqErr(err)
+	}
+
 	err = json.Unmarshal(reqBodyJson, reqBody)
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal response body. %s", err.Error())
+		return newBadReqErr(
+			fmt.Errorf("unable to unmarshal request body. %s", err.Error()))
 	}
 
 	return nil
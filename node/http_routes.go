@@ -1,58 +1,67 @@
 package node
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/client"
 	"github.com/simone-trubian/blockchain-tutorial/database"
 	"github.com/simone-trubian/blockchain-tutorial/wallet"
 )
 
-type ErrRes struct {
-	Error string `json:"error"`
-}
-
-type BalancesRes struct {
-	Hash     database.Hash           `json:"block_hash"`
-	Balances map[common.Address]uint `json:"balances"`
-}
+// The request and response types shared with the Go SDK.
+type ErrRes = client.ErrRes
+type BalancesRes = client.BalancesRes
+type TxAddReq = client.TxAddReq
+type TxAddRes = client.TxAddRes
+type TxSubmitRes = client.TxSubmitRes
+type StatusRes = client.StatusRes
+type SyncRes = client.SyncRes
+type HeadersRes = client.HeadersRes
+type HandshakeRes = client.HandshakeRes
+type AddPeerRes = client.AddPeerRes
 
-type TxAddReq struct {
-	From    string `json:"from"`
-	FromPwd string `json:"from_pwd"`
-	To      string `json:"to"`
-	Value   uint   `json:"value"`
-	Data    string `json:"data"`
-}
+const TxStatusPending = "pending"
+const TxStatusIncluded = "included"
+const TxStatusUnknown = "unknown"
 
-type TxAddRes struct {
-	Success bool `json:"success"`
+type TxStatusRes struct {
+	Hash          database.Hash `json:"hash"`
+	Status        string        `json:"status"`
+	BlockHash     database.Hash `json:"block_hash"`
+	BlockNumber   uint64        `json:"block_number"`
+	Confirmations uint64        `json:"confirmations"`
 }
 
-type StatusRes struct {
-	Hash       database.Hash       `json:"block_hash"`
-	Number     uint64              `json:"block_number"`
-	KnownPeers map[string]PeerNode `json:"peers_known"`
-	PendingTXs []database.SignedTx `json:"pending_txs"`
+type BlockTxRes struct {
+	Hash database.Hash `json:"hash"`
+	database.SignedTx
 }
 
-type SyncRes struct {
-	Blocks []database.Block `json:"blocks"`
+type BlockRes struct {
+	Hash   database.Hash        `json:"hash"`
+	Header database.BlockHeader `json:"header"`
+	TXs    []BlockTxRes         `json:"txs"`
 }
 
-type AddPeerRes struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
+type BlocksRes struct {
+	Blocks []BlockRes `json:"blocks"`
 }
 
 func listBalancesHandler(
 	w http.ResponseWriter, r *http.Request, state *database.State) {
-	writeRes(w, BalancesRes{state.LatestBlockHash(), state.Balances})
+	writeRes(w, BalancesRes{Hash: state.LatestBlockHash(), Balances: state.BalancesCopy()})
 }
 
 func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodPost) {
+		return
+	}
+
 	req := TxAddReq{}
 	err := readReq(r, &req)
 	if err != nil {
@@ -60,17 +69,22 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
-	from := database.NewAccount(req.From)
+	if !common.IsHexAddress(req.From) {
+		writeErrRes(w, newBadReqErr(fmt.Errorf("'%s' is an invalid 'from' sender", req.From)))
+		return
+	}
 
-	if from.String() == common.HexToAddress("").String() {
-		writeErrRes(w, fmt.Errorf("%s is an invalid 'from' sender", from.String()))
+	if !common.IsHexAddress(req.To) {
+		writeErrRes(w, newBadReqErr(fmt.Errorf("'%s' is an invalid 'to' receiver", req.To)))
 		return
 	}
 
+	from := database.NewAccount(req.From)
+
 	if req.FromPwd == "" {
-		writeErrRes(w, fmt.Errorf(
+		writeErrRes(w, newBadReqErr(fmt.Errorf(
 			"password to decrypt the %s account is required. 'from_pwd' is empty",
-			from.String()))
+			from.String())))
 		return
 	}
 
@@ -78,6 +92,13 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 
 	signedTx, err := wallet.SignTxWithKeystoreAccount(
 		tx, from, req.FromPwd, wallet.GetKeystoreDirPath(node.dataDir))
+	if err != nil {
+		// Unknown account or wrong password
+		writeErrRes(w, newBadReqErr(err))
+		return
+	}
+
+	txHash, err := signedTx.Hash()
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -89,56 +110,474 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
-	writeRes(w, TxAddRes{Success: true})
+	writeRes(w, TxAddRes{Success: true, Hash: txHash})
+}
+
+// txSubmitHandler adds a TX signed client-side into the Mempool, so the
+// sender password and private key never reach the node.
+func txSubmitHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodPost) {
+		return
+	}
+
+	signedTx := database.SignedTx{}
+	err := readReq(r, &signedTx)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	txHash, err := node.submitSignedTx(signedTx)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, TxSubmitRes{Hash: txHash})
+}
+
+// submitSignedTx verifies the TX signature, the sender balance and that
+// the TX isn't already included in the chain before adding the TX into
+// the Mempool.
+func (n *Node) submitSignedTx(signedTx database.SignedTx) (database.Hash, error) {
+	if len(signedTx.Sig) == 0 {
+		return database.Hash{}, newBadReqErr(fmt.Errorf("TX 'signature' is required"))
+	}
+
+	isAuthentic, err := signedTx.IsAuthentic()
+	if err != nil {
+		return database.Hash{}, newBadReqErr(err)
+	}
+
+	if !isAuthentic {
+		return database.Hash{}, newBadReqErr(fmt.Errorf(
+			"wrong TX. Sender '%s' is forged", signedTx.From.String()))
+	}
+
+	if signedTx.Value > n.state.Balance(signedTx.From) {
+		return database.Hash{}, newBadReqErr(fmt.Errorf(
+			"wrong TX. Sender '%s' balance is %d SB. Tx cost is %d SB",
+			signedTx.From.String(),
+			n.state.Balance(signedTx.From),
+			signedTx.Value))
+	}
+
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		return database.Hash{}, err
+	}
+
+	// TXs have no nonce, a mined TX would move the funds again
+	if entry, isIncluded := n.state.GetTxIndexEntry(txHash); isIncluded {
+		return database.Hash{}, statusErr{http.StatusConflict, fmt.Errorf(
+			"%w, TX '%s' was included in block %d",
+			database.ErrTxAlreadyIncluded,
+			txHash.Hex(),
+			entry.BlockNumber)}
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		return database.Hash{}, err
+	}
+
+	return txHash, nil
+}
+
+// txStatusHandler reports whether the TX is still pending, was included
+// in a block or is unknown to this node, e.g. because it got dropped.
+func txStatusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet) {
+		return
+	}
+
+	reqHash := strings.TrimPrefix(r.URL.Path, endpointTx)
+
+	txHash, err := parseHash(reqHash)
+	if err != nil {
+		writeErrResWithStatus(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeRes(w, node.txStatus(txHash))
+}
+
+func (n *Node) txStatus(txHash database.Hash) TxStatusRes {
+	res := TxStatusRes{Hash: txHash, Status: TxStatusUnknown}
+
+	if entry, isIncluded := n.state.GetTxIndexEntry(txHash); isIncluded {
+		res.Status = TxStatusIncluded
+		res.BlockHash = entry.BlockHash
+		res.BlockNumber = entry.BlockNumber
+		res.Confirmations = n.state.LatestBlock().Header.Number - entry.BlockNumber + 1
+	} else if n.isPendingTX(txHash) {
+		res.Status = TxStatusPending
+	}
+
+	return res
+}
+
+// blockHandler serves a single block by `/blocks/latest`,
+// `/blocks/{number}` or `/blocks/hash/{hash}`.
+func blockHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet) {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, endpointBlock)
+
+	var res BlockRes
+	var isFound bool
+	var err error
+
+	switch {
+	case path == endpointBlockLatest:
+		res, isFound, err = node.latestBlockRes()
+
+	case strings.HasPrefix(path, endpointBlockByHash):
+		reqHash := strings.TrimPrefix(path, endpointBlockByHash)
+
+		hash, parseErr := parseHash(reqHash)
+		if parseErr != nil {
+			writeErrResWithStatus(w, parseErr, http.StatusBadRequest)
+			return
+		}
+
+		res, isFound, err = node.blockResByHash(hash)
+
+	default:
+		number, parseErr := strconv.ParseUint(path, 10, 64)
+		if parseErr != nil {
+			writeErrResWithStatus(
+				w, fmt.Errorf("'%s' is an invalid block number", path), http.StatusBadRequest)
+			return
+		}
+
+		res, isFound, err = node.blockResByNumber(number)
+	}
+
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if !isFound {
+		writeErrResWithStatus(w, fmt.Errorf("block not found"), http.StatusNotFound)
+		return
+	}
+
+	writeRes(w, res)
+}
+
+func (n *Node) latestBlockRes() (BlockRes, bool, error) {
+	if n.state.LatestBlockHash().IsEmpty() {
+		return BlockRes{}, false, nil
+	}
+
+	res, err := newBlockRes(database.BlockFS{
+		Key:   n.state.LatestBlockHash(),
+		Value: n.state.LatestBlock(),
+	})
+
+	return res, err == nil, err
+}
+
+func (n *Node) blockResByNumber(number uint64) (BlockRes, bool, error) {
+	blockFs, isFound, err := database.GetBlockByNumber(number, n.dataDir)
+	if err != nil || !isFound {
+		return BlockRes{}, false, err
+	}
+
+	res, err := newBlockRes(blockFs)
+
+	return res, err == nil, err
+}
+
+func (n *Node) blockResByHash(hash database.Hash) (BlockRes, bool, error) {
+	blockFs, isFound, err := database.GetBlockByHash(hash, n.dataDir)
+	if err != nil || !isFound {
+		return BlockRes{}, false, err
+	}
+
+	res, err := newBlockRes(blockFs)
+
+	return res, err == nil, err
+}
+
+// blocksHandler serves the blocks numbered `from` to `to`, both included,
+// at most blocksMaxRange at once.
+func blocksHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet) {
+		return
+	}
+
+	from, err := strconv.ParseUint(r.URL.Query().Get(endpointBlocksQueryKeyFrom), 10, 64)
+	if err != nil {
+		writeErrResWithStatus(
+			w, fmt.Errorf("'from' must be a block number. %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	to := from + blocksMaxRange - 1
+	reqTo := r.URL.Query().Get(endpointBlocksQueryKeyTo)
+	if reqTo != "" {
+		to, err = strconv.ParseUint(reqTo, 10, 64)
+		if err != nil {
+			writeErrResWithStatus(
+				w, fmt.Errorf("'to' must be a block number. %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if to < from {
+		writeErrResWithStatus(w, fmt.Errorf("'to' must not be lower than 'from'"), http.StatusBadRequest)
+		return
+	}
+
+	if to-from >= blocksMaxRange {
+		writeErrResWithStatus(
+			w, fmt.Errorf("at most %d blocks can be queried at once", blocksMaxRange), http.StatusBadRequest)
+		return
+	}
+
+	blocks, err := database.GetBlocksByNumberRange(from, to, node.dataDir)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	res := BlocksRes{Blocks: make([]BlockRes, 0, len(blocks))}
+	for _, blockFs := range blocks {
+		blockRes, err := newBlockRes(blockFs)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		res.Blocks = append(res.Blocks, blockRes)
+	}
+
+	writeRes(w, res)
+}
+
+// parseHash parses a hex encoded block or TX hash.
+func parseHash(raw string) (database.Hash, error) {
+	hash := database.Hash{}
+
+	if len(raw) != hex.EncodedLen(len(hash)) {
+		return database.Hash{}, fmt.Errorf("'%s' is an invalid hash", raw)
+	}
+
+	err := hash.UnmarshalText([]byte(raw))
+	if err != nil {
+		return database.Hash{}, err
+	}
+
+	return hash, nil
+}
+
+func newBlockRes(blockFs database.BlockFS) (BlockRes, error) {
+	txs := make([]BlockTxRes, 0, len(blockFs.Value.TXs))
+
+	for _, tx := range blockFs.Value.TXs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return BlockRes{}, err
+		}
+
+		txs = append(txs, BlockTxRes{txHash, tx})
+	}
+
+	return BlockRes{blockFs.Key, blockFs.Value.Header, txs}, nil
 }
 
 func statusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	res := StatusRes{
 		Hash:       node.state.LatestBlockHash(),
 		Number:     node.state.LatestBlock().Header.Number,
-		KnownPeers: node.knownPeers,
+		KnownPeers: make(map[string]client.Peer),
 		PendingTXs: node.getPendingTXsAsArray(),
 	}
 
+	for tcpAddress, peer := range node.knownPeersCopy() {
+		res.KnownPeers[tcpAddress] = peer.clientPeer()
+	}
+
 	writeRes(w, res)
 }
 
 func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	hash, limit, err := readSyncQuery(r)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	blocks, hasMore, err := database.GetBlocksAfterWithLimit(
+		hash, node.dataDir, limit)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	res := SyncRes{Blocks: blocks, HasMore: hasMore}
+
+	// The cursor for the next page is the last block of this one
+	if hasMore {
+		res.NextFromBlock, err = blocks[len(blocks)-1].Hash()
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+	}
+
+	writeRes(w, res)
+}
+
+func headersHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	hash, limit, err := readSyncQuery(r)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	headers, hasMore, err := database.GetBlockHeadersAfterWithLimit(
+		hash, node.dataDir, limit)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, HeadersRes{Headers: headers, HasMore: hasMore})
+}
+
+// readSyncQuery parses the `fromBlock` cursor and the page `limit`,
+// capped to syncMaxBlocksPerPage.
+func readSyncQuery(r *http.Request) (database.Hash, int, error) {
 	reqHash := r.URL.Query().Get(endpointSyncQueryKeyFromBlock)
 
 	hash := database.Hash{}
 	err := hash.UnmarshalText([]byte(reqHash))
+	if err != nil {
+		return database.Hash{}, 0, newBadReqErr(err)
+	}
+
+	limit := syncMaxBlocksPerPage
+	reqLimit := r.URL.Query().Get(endpointSyncQueryKeyLimit)
+	if reqLimit != "" {
+		parsedLimit, err := strconv.ParseUint(reqLimit, 10, 32)
+		if err != nil {
+			return database.Hash{}, 0, newBadReqErr(err)
+		}
+
+		if parsedLimit > 0 && parsedLimit < syncMaxBlocksPerPage {
+			limit = int(parsedLimit)
+		}
+	}
+
+	return hash, limit, nil
+}
+
+func handshakeHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	challenge := r.URL.Query().Get(endpointHandshakeQueryKeyChallenge)
+	peerIP := r.URL.Query().Get(endpointHandshakeQueryKeyIP)
+	peerPortRaw := r.URL.Query().Get(endpointHandshakeQueryKeyPort)
+
+	if len(challenge) != hex.EncodedLen(handshakeChallengeLength) {
+		writeErrRes(w, newBadReqErr(
+			fmt.Errorf("handshake challenge must be %d bytes long", handshakeChallengeLength)))
+		return
+	}
+
+	peerPort, err := strconv.ParseUint(peerPortRaw, 10, 32)
+	if err != nil {
+		writeErrRes(w, newBadReqErr(err))
+		return
+	}
+
+	joiningPeer := NewPeerNode(peerIP, peerPort, false, common.Address{}, false)
+
+	sig, err := node.signHandshake(challenge, joiningPeer.TcpAddress())
 	if err != nil {
 		writeErrRes(w, err)
 		return
 	}
 
-	blocks, err := database.GetBlocksAfter(hash, node.dataDir)
+	ownChallenge, err := node.issueHandshakeChallenge()
 	if err != nil {
 		writeErrRes(w, err)
 		return
 	}
 
-	writeRes(w, SyncRes{Blocks: blocks})
+	writeRes(w, HandshakeRes{Challenge: ownChallenge, Account: node.info.Account, Sig: sig})
 }
 
 func addPeerHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	peerIP := r.URL.Query().Get(endpointAddPeerQueryKeyIP)
 	peerPortRaw := r.URL.Query().Get(endpointAddPeerQueryKeyPort)
-	minerRaw := r.URL.Query().Get(endpointAddPeerQueryKeyMiner)
+	accountRaw := r.URL.Query().Get(endpointAddPeerQueryKeyAccount)
+	challenge := r.URL.Query().Get(endpointAddPeerQueryKeyChallenge)
+	sigRaw := r.URL.Query().Get(endpointAddPeerQueryKeySig)
+	isTLS := r.URL.Query().Get(endpointAddPeerQueryKeyTLS) == "true"
 
 	peerPort, err := strconv.ParseUint(peerPortRaw, 10, 32)
 	if err != nil {
-		writeRes(w, AddPeerRes{false, err.Error()})
+		writeRes(w, AddPeerRes{Error: err.Error()})
+		return
+	}
+
+	sig, err := hex.DecodeString(sigRaw)
+	if err != nil {
+		writeRes(w, AddPeerRes{Error: err.Error()})
 		return
 	}
 
 	peer := NewPeerNode(
-		peerIP, peerPort, false, database.NewAccount(minerRaw), true)
+		peerIP, peerPort, false, database.NewAccount(accountRaw), true)
+	peer.TLS = isTLS
+
+	if node.IsBannedPeer(peer) {
+		writeRes(w, AddPeerRes{Error: fmt.Sprintf(
+			"peer '%s' is banned", peer.TcpAddress())})
+		return
+	}
+
+	_, isKnownPeer := node.knownPeer(peer.TcpAddress())
+	if !node.acceptPeers && !isKnownPeer {
+		writeRes(w, AddPeerRes{Error: "node only accepts the peers added by its admin"})
+		return
+	}
+
+	if !node.consumeHandshakeChallenge(challenge) {
+		writeRes(w, AddPeerRes{Error: "handshake challenge is unknown or expired"})
+		return
+	}
+
+	err = verifyHandshake(challenge, peer.TcpAddress(), sig, peer.Account)
+	if err != nil {
+		writeRes(w, AddPeerRes{Error: err.Error()})
+		return
+	}
+
+	// The Peer is only connected once reached back at its address
+	err = node.verifyPeerAddress(r.Context(), peer)
+	if err != nil {
+		writeRes(w, AddPeerRes{Error: err.Error()})
+		return
+	}
+
+	// Re-joining must not reset the score of a misbehaving Peer
+	node.peersMu.Lock()
+	if knownPeer, isKnownPeer := node.knownPeers[peer.TcpAddress()]; isKnownPeer {
+		peer.score = knownPeer.score
+		peer.IsBootstrap = knownPeer.IsBootstrap
+	}
 
-	node.AddPeer(peer)
+	node.addKnownPeer(peer)
+	node.peersMu.Unlock()
 
-	fmt.Printf("Peer '%s' was added into KnownPeers\n", peer.TcpAddress())
+	node.peersLogger.Info(
+		"Peer joined KnownPeers", "peer", peer.TcpAddress(), "account", peer.Account.String())
 
-	writeRes(w, AddPeerRes{true, ""})
+	writeRes(w, AddPeerRes{Success: true})
 }
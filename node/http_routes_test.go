@@ -0,0 +1,359 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+func TestTxSubmitHandler(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithState(t, map[common.Address]uint{sender: 1000})
+
+	tx := database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, "")
+	signedTx, err := wallet.SignTx(tx, senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := submitTestTx(t, n, signedTx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("signed TX should be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	res := TxSubmitRes{}
+	err = json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Hash != txHash {
+		t.Fatal("response should contain the TX hash")
+	}
+
+	if _, isPending := n.pendingTXs[txHash.Hex()]; !isPending {
+		t.Fatal("submitted TX should be pending")
+	}
+
+	forgedTx := signedTx
+	forgedTx.Value = 100
+
+	rec = submitTestTx(t, n, forgedTx)
+	if rec.Code == http.StatusOK {
+		t.Fatal("TX modified after signing should be rejected")
+	}
+
+	expensiveTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 5000, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = submitTestTx(t, n, expensiveTx)
+	if rec.Code == http.StatusOK {
+		t.Fatal("TX exceeding the sender balance should be rejected")
+	}
+}
+
+func TestTxSubmitHandler_RejectsMinedTX(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Any nonce seals a Dev block
+	n := newTestNodeWithConsensus(
+		t, map[common.Address]uint{sender: 1000}, database.ConsensusConfig{Engine: consensus.EngineDev})
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := submitTestTx(t, n, signedTx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("signed TX should be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	txBlock := NewPendingBlock(
+		n.state.LatestBlockHash(), n.state.NextBlockNumber(), n.minerAccount(), n.getPendingTXsAsArray()).block(0)
+	err = n.addBlock(txBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.removeMinedPendingTXs(txBlock)
+
+	// A restarted node no longer has the mined TX archived
+	n.mempoolMu.Lock()
+	n.archivedTXs = make(map[string]database.SignedTx)
+	n.mempoolMu.Unlock()
+
+	rec = submitTestTx(t, n, signedTx)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("mined TX resubmitted should be rejected with %d, got %d: %s",
+			http.StatusConflict, rec.Code, rec.Body.String())
+	}
+
+	if n.pendingTXsCount() != 0 {
+		t.Fatal("mined TX resubmitted shouldn't be pending")
+	}
+
+	if n.state.Balance(sender) != 990 {
+		t.Fatalf("mined TX should be applied once, sender balance is %d", n.state.Balance(sender))
+	}
+}
+
+func submitTestTx(
+	t *testing.T, n *Node, tx database.SignedTx) *httptest.ResponseRecorder {
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/tx/submit", bytes.NewReader(txJson))
+	rec := httptest.NewRecorder()
+
+	txSubmitHandler(rec, req, n)
+
+	return rec
+}
+
+// newTestNodeWithState creates a node with its state loaded from a new
+// data dir with the given genesis balances, without running it.
+func newTestNodeWithState(
+	t *testing.T, genesisBalances map[common.Address]uint) *Node {
+	return newTestNodeWithConsensus(t, genesisBalances, database.ConsensusConfig{})
+}
+
+func newTestNodeWithConsensus(
+	t *testing.T,
+	genesisBalances map[common.Address]uint,
+	consensusCfg database.ConsensusConfig) *Node {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.RemoveDir(dataDir) })
+
+	genesisJson, err := json.Marshal(database.Genesis{Balances: genesisBalances, Consensus: consensusCfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = database.InitDataDirIfNotExists(dataDir, genesisJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := consensus.New(consensusCfg, consensus.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := database.NewStateFromDisk(dataDir, engine, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { state.Close() })
+
+	n := New(newTestConfig(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), []PeerNode{}), logger.Discard())
+	n.state = state
+	n.consensus = engine
+
+	return n
+}
+
+func TestTxStatusHandler(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Any nonce seals a Dev block
+	n := newTestNodeWithConsensus(
+		t, map[common.Address]uint{sender: 1000}, database.ConsensusConfig{Engine: consensus.EngineDev})
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := getTestTxStatus(t, n, txHash.Hex())
+	if res.Status != TxStatusUnknown {
+		t.Fatalf("TX not submitted yet should be unknown, got %s", res.Status)
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = getTestTxStatus(t, n, txHash.Hex())
+	if res.Status != TxStatusPending || res.Hash != txHash {
+		t.Fatalf("submitted TX should be pending, got %s", res.Status)
+	}
+
+	txBlock := NewPendingBlock(
+		n.state.LatestBlockHash(), n.state.NextBlockNumber(), n.minerAccount(), n.getPendingTXsAsArray()).block(0)
+	err = n.addBlock(txBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.removeMinedPendingTXs(txBlock)
+
+	txBlockHash, err := txBlock.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.addBlock(NewPendingBlock(txBlockHash, n.state.NextBlockNumber(), n.minerAccount(), nil).block(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = getTestTxStatus(t, n, txHash.Hex())
+	if res.Status != TxStatusIncluded ||
+		res.BlockHash != txBlockHash ||
+		res.BlockNumber != 0 ||
+		res.Confirmations != 2 {
+		t.Fatalf("mined TX should be included with 2 confirmations, got %+v", res)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, endpointTx+"nope", nil)
+	rec := httptest.NewRecorder()
+	txStatusHandler(rec, req, n)
+	if rec.Code == http.StatusOK {
+		t.Fatal("invalid TX hash should be rejected")
+	}
+}
+
+func getTestTxStatus(t *testing.T, n *Node, txHash string) TxStatusRes {
+	req := httptest.NewRequest(http.MethodGet, endpointTx+txHash, nil)
+	rec := httptest.NewRecorder()
+
+	txStatusHandler(rec, req, n)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	res := TxStatusRes{}
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestBlockHandlers(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+
+	blocks, headers := createTestChain(t, 5)
+	appendTestBlocks(t, n.dataDir, blocks, headers)
+
+	res := BlockRes{}
+	getTestJson(t, n, blockHandler, endpointBlock+"3", &res)
+	if res.Hash != headers[3].Key || res.Header.Number != 3 {
+		t.Fatal("block 3 should be served by its number")
+	}
+
+	getTestJson(t, n, blockHandler, endpointBlock+endpointBlockByHash+headers[1].Key.Hex(), &res)
+	if res.Header.Number != 1 {
+		t.Fatal("block 1 should be served by its hash")
+	}
+
+	blocksRes := BlocksRes{}
+	getTestJson(t, n, blocksHandler, endpointBlocks+"?from=1&to=2", &blocksRes)
+	if len(blocksRes.Blocks) != 2 || blocksRes.Blocks[1].Hash != headers[2].Key {
+		t.Fatal("blocks 1 to 2 should be served")
+	}
+
+	rec := httptest.NewRecorder()
+	blockHandler(rec, httptest.NewRequest(http.MethodGet, endpointBlock+"10", nil), n)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("missing block should be not found, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	blocksHandler(rec, httptest.NewRequest(http.MethodGet, endpointBlocks+"?from=3&to=1", nil), n)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid range should be a bad request, got %d", rec.Code)
+	}
+}
+
+func getTestJson(
+	t *testing.T,
+	n *Node,
+	handler func(http.ResponseWriter, *http.Request, *Node),
+	target string,
+	res interface{}) {
+	rec := httptest.NewRecorder()
+
+	handler(rec, httptest.NewRequest(http.MethodGet, target, nil), n)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	err := json.Unmarshal(rec.Body.Bytes(), res)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// appendTestBlocks persists the blocks without validating them.
+func appendTestBlocks(
+	t *testing.T,
+	dataDir string,
+	blocks []database.Block,
+	headers []database.BlockHeaderFS) {
+	f, err := os.OpenFile(
+		filepath.Join(dataDir, "database", "block.db"), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for i, b := range blocks {
+		blockFsJson, err := json.Marshal(database.BlockFS{Key: headers[i].Key, Value: b})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = f.Write(append(blockFsJson, '\n'))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultReadTimeout is how long a client gets to send its whole request.
+const DefaultReadTimeout = 15 * time.Second
+
+// DefaultWriteTimeout is how long the node gets to write a response, long
+// enough to serve a full /node/sync page.
+const DefaultWriteTimeout = 30 * time.Second
+
+const DefaultMaxBodyBytes = 1 << 20
+
+// rateBucketIdleTimeout is how long the bucket of a client is kept after
+// its last request.
+const rateBucketIdleTimeout = 10 * time.Minute
+
+// RateLimit is a token bucket refilled with RPS tokens per second and
+// holding at most Burst tokens, one token per request. A zero RPS
+// disables the limit.
+type RateLimit struct {
+	RPS   float64
+	Burst int
+}
+
+// DefaultRateLimit caps the requests of a client IP to the routes without
+// a RateLimit of their own.
+var DefaultRateLimit = RateLimit{RPS: 20, Burst: 40}
+
+// DefaultPeerRateLimit caps the routes a syncing Peer calls, high enough
+// for a Peer downloading blocks in parallel to never be refused.
+var DefaultPeerRateLimit = RateLimit{RPS: 100, Burst: 200}
+
+// DefaultRouteRateLimits caps the expensive routes harder: /tx/add decrypts
+// a keystore with scrypt on every request. The sync routes get the higher
+// DefaultPeerRateLimit while the handshake routes keep DefaultRateLimit.
+func DefaultRouteRateLimits() map[string]RateLimit {
+	return map[string]RateLimit{
+		"/tx/add":       {RPS: 0.5, Burst: 3},
+		endpointStatus:  DefaultPeerRateLimit,
+		endpointSync:    DefaultPeerRateLimit,
+		endpointHeaders: DefaultPeerRateLimit,
+	}
+}
+
+var errReqBodyTooLarge = errors.New("request body is too large")
+
+// rateLimiter keeps a token bucket per client IP and route.
+type rateLimiter struct {
+	defaultLimit RateLimit
+	routeLimits  map[string]RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(defaultLimit RateLimit, routeLimits map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		defaultLimit: defaultLimit,
+		routeLimits:  routeLimits,
+		buckets:      make(map[string]*rateBucket),
+		lastSweep:    time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of the client `ip` calling the
+// `route`. Without any token left, it returns how long to wait for one.
+func (rl *rateLimiter) allow(route string, ip string, now time.Time) (bool, time.Duration) {
+	limit, hasRouteLimit := rl.routeLimits[route]
+	if !hasRouteLimit {
+		limit = rl.defaultLimit
+	}
+
+	if limit.RPS <= 0 {
+		return true, 0
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	key := route + " " + ip
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &rateBucket{limiter: rate.NewLimiter(rate.Limit(limit.RPS), limit.Burst)}
+		rl.buckets[key] = bucket
+	}
+	bucket.lastSeen = now
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return false, rateBucketIdleTimeout
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// sweep forgets the buckets of the clients gone idle, so the buckets don't
+// pile up with every IP ever seen.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rateBucketIdleTimeout {
+		return
+	}
+
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.lastSeen) > rateBucketIdleTimeout {
+			delete(rl.buckets, key)
+		}
+	}
+
+	rl.lastSweep = now
+}
+
+// limit answers 429 to the clients exceeding the rate limit of the `mux`
+// route they call.
+//
+// Clients are told apart by their connection IP, as the forwarded headers
+// can be forged.
+func (rl *rateLimiter) limit(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		isAllowed, retryAfter := rl.allow(route, ip, time.Now())
+		if !isAllowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeErrResWithStatus(
+				w,
+				fmt.Errorf("too many requests, retry in %s", retryAfter.Round(time.Millisecond)),
+				http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitReqBody answers 413 to requests with a body over `maxBytes`. Bodies
+// of unknown length fail with errReqBodyTooLarge once read past the limit.
+func limitReqBody(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			writeErrResWithStatus(w, errReqBodyTooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = &limitedBody{r.Body, maxBytes}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errReqBodyTooLarge
+	}
+
+	// Reading one byte past the limit tells a body of exactly the limit
+	// from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+
+		return n, errReqBodyTooLarge
+	}
+
+	b.remaining -= int64(n)
+
+	return n, err
+}
@@ -0,0 +1,127 @@
+package node
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(RateLimit{RPS: 10, Burst: 2}, map[string]RateLimit{
+		"/tx/add":  {RPS: 1, Burst: 1},
+		"/healthz": {},
+	})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if isAllowed, _ := rl.allow("/balances/list", "10.0.0.1", now); !isAllowed {
+			t.Fatal("requests within the burst should be allowed")
+		}
+	}
+
+	isAllowed, retryAfter := rl.allow("/balances/list", "10.0.0.1", now)
+	if isAllowed || retryAfter != 100*time.Millisecond {
+		t.Fatalf("request over the burst should wait for the next token, got %t %s", isAllowed, retryAfter)
+	}
+
+	if isAllowed, _ := rl.allow("/balances/list", "10.0.0.2", now); !isAllowed {
+		t.Fatal("clients should have their own bucket")
+	}
+
+	if isAllowed, _ := rl.allow("/tx/add", "10.0.0.1", now); !isAllowed {
+		t.Fatal("routes should have their own bucket")
+	}
+	if isAllowed, retryAfter := rl.allow("/tx/add", "10.0.0.1", now); isAllowed || retryAfter != time.Second {
+		t.Fatalf("route limit should override the default one, got %t %s", isAllowed, retryAfter)
+	}
+
+	if isAllowed, _ := rl.allow("/balances/list", "10.0.0.1", now.Add(100*time.Millisecond)); !isAllowed {
+		t.Fatal("bucket should be refilled over time")
+	}
+
+	for i := 0; i < 100; i++ {
+		if isAllowed, _ := rl.allow("/healthz", "10.0.0.1", now); !isAllowed {
+			t.Fatal("route without rps should be unlimited")
+		}
+	}
+
+	rl.allow("/balances/list", "10.0.0.3", now.Add(2*rateBucketIdleTimeout))
+	if len(rl.buckets) != 1 {
+		t.Fatalf("idle buckets should be swept, got %d", len(rl.buckets))
+	}
+}
+
+func TestRateLimiter_AllowsParallelSync(t *testing.T) {
+	rl := newRateLimiter(DefaultRateLimit, DefaultRouteRateLimits())
+	now := time.Now()
+
+	// A node downloading a whole sync page from this single peer
+	for i := 0; i < syncMaxBlocksPerPage/syncBlocksPerDownload*syncMaxParallelDownloads; i++ {
+		if isAllowed, _ := rl.allow(endpointSync, "10.0.0.1", now); !isAllowed {
+			t.Fatalf("sync request %d of a peer should be allowed", i)
+		}
+	}
+
+	for i := 0; i < DefaultRateLimit.Burst; i++ {
+		rl.allow(endpointHandshake, "10.0.0.1", now)
+	}
+	if isAllowed, _ := rl.allow(endpointHandshake, "10.0.0.1", now); isAllowed {
+		t.Fatal("handshake should keep the default rate limit")
+	}
+}
+
+func TestRateLimiter_Answers429(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpointHealthz, healthzHandler)
+
+	handler := newRateLimiter(RateLimit{RPS: 1, Burst: 1}, nil).limit(mux, mux)
+
+	codes := make([]int, 0)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, endpointHealthz, nil))
+		codes = append(codes, rec.Code)
+
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Fatalf("429 should tell when to retry, got '%s'", rec.Header().Get("Retry-After"))
+		}
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("second request should be rate limited, got %v", codes)
+	}
+}
+
+func TestLimitReqBody(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	handler := limitReqBody(16, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		txSubmitHandler(w, r, n)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tx/submit", strings.NewReader(strings.Repeat(" ", 17))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body over the limit should be refused, got %d", rec.Code)
+	}
+
+	// Without a Content-Length, the body is cut while being read
+	req := httptest.NewRequest(http.MethodPost, "/tx/submit", ioutil.NopCloser(strings.NewReader(strings.Repeat(" ", 17))))
+	req.ContentLength = -1
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("streamed body over the limit should be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	body := &limitedBody{ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 16))), 16}
+	content, err := ioutil.ReadAll(body)
+	if err != nil || len(content) != 16 {
+		t.Fatalf("body of exactly the limit should be read, got %d bytes, %v", len(content), err)
+	}
+}
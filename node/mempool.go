@@ -0,0 +1,82 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const mempoolFileName = "mempool.json"
+
+// LoadMempool reads the pending TXs flushed to the data dir by the last
+// shutdown.
+func LoadMempool(dataDir string) ([]database.SignedTx, error) {
+	txs := make([]database.SignedTx, 0)
+
+	content, err := ioutil.ReadFile(getMempoolFilePath(dataDir))
+	if os.IsNotExist(err) {
+		return txs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &txs)
+	if err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+func writeMempoolToDisk(dataDir string, txs []database.SignedTx) error {
+	txsJson, err := json.MarshalIndent(txs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(getMempoolFilePath(dataDir), txsJson, 0600)
+}
+
+// restoreMempool puts back the pending TXs flushed by the last shutdown,
+// skipping the ones mined in the meantime.
+func (n *Node) restoreMempool() error {
+	txs, err := LoadMempool(n.dataDir)
+	if err != nil {
+		return err
+	}
+
+	n.mempoolMu.Lock()
+	defer n.mempoolMu.Unlock()
+
+	for _, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+
+		if _, isIncluded := n.state.GetTxIndexEntry(txHash); isIncluded {
+			continue
+		}
+
+		n.pendingTXs[txHash.Hex()] = tx
+	}
+
+	if len(n.pendingTXs) > 0 {
+		n.logger.Info("Restored pending TXs", "count", len(n.pendingTXs))
+	}
+
+	return nil
+}
+
+// flushMempool persists the pending TXs so they survive a restart.
+func (n *Node) flushMempool() error {
+	return writeMempoolToDisk(n.dataDir, n.getPendingTXsAsArray())
+}
+
+func getMempoolFilePath(dataDir string) string {
+	return filepath.Join(dataDir, mempoolFileName)
+}
@@ -0,0 +1,53 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+func TestMempoolSurvivesRestart(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithState(t, map[common.Address]uint{sender: 1000})
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.flushMempool()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := New(newTestConfig(n.dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), []PeerNode{}), logger.Discard())
+	restarted.state = n.state
+
+	err = restarted.restoreMempool()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, isPending := restarted.pendingTXs[txHash.Hex()]; !isPending || len(restarted.pendingTXs) != 1 {
+		t.Fatalf("flushed TX should be pending again after a restart, got %d pending TXs", len(restarted.pendingTXs))
+	}
+}
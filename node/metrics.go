@@ -0,0 +1,191 @@
+package node
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
+)
+
+const endpointMetrics = "/metrics"
+
+// metricsRouteUnmatched labels the requests not matching any endpoint, so
+// random paths don't create new series.
+const metricsRouteUnmatched = "unmatched"
+
+// metricsMethodOther labels the requests of any other method than
+// metricsMethods, so clients can't create new series with custom methods.
+const metricsMethodOther = "other"
+
+var metricsMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodHead:    true,
+}
+
+// metricsInvalidNameChars are replaced in the label values appended to the
+// metric names, keeping them valid Prometheus names.
+var metricsInvalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+func init() {
+	// The node always serves its metrics, the go-ethereum constructors
+	// return no-op stubs otherwise
+	metrics.Enabled = true
+}
+
+// nodeMetrics are served in the Prometheus format by the go-ethereum
+// exporter, turning the "/" of the names into "_". The exporter has no
+// labels, the label values are appended to the metric names instead, as
+// go-ethereum does.
+type nodeMetrics struct {
+	registry metrics.Registry
+
+	minerAttempts metrics.Counter
+	blockApply    metrics.Timer
+}
+
+// newNodeMetrics registers the `n` metrics. The chain, mempool and peers
+// gauges are read from the node whenever the metrics are scraped.
+func newNodeMetrics(n *Node) *nodeMetrics {
+	registry := metrics.NewRegistry()
+
+	m := &nodeMetrics{
+		registry:      registry,
+		minerAttempts: metrics.NewRegisteredCounter("sb/miner/attempts/total", registry),
+		blockApply:    metrics.NewRegisteredTimer("sb/block/apply/duration", registry),
+	}
+
+	metrics.NewRegisteredFunctionalGauge("sb/chain/height", registry, func() int64 {
+		if n.state == nil {
+			return 0
+		}
+
+		return int64(n.state.LatestBlock().Header.Number)
+	})
+
+	metrics.NewRegisteredFunctionalGauge("sb/mempool/txs", registry, func() int64 {
+		return int64(n.pendingTXsCount())
+	})
+
+	metrics.NewRegisteredFunctionalGauge("sb/peers/known", registry, func() int64 {
+		return int64(len(n.knownPeersCopy()))
+	})
+
+	metrics.NewRegisteredFunctionalGauge("sb/peers/connected", registry, func() int64 {
+		connected := 0
+		for _, peer := range n.knownPeersCopy() {
+			if peer.connected {
+				connected++
+			}
+		}
+
+		return int64(connected)
+	})
+
+	return m
+}
+
+// metricName appends the `labelValues` to the `name`, e.g. the route
+// "/tx/add" to "sb/http/requests" gives "sb/http/requests/tx_add".
+func metricName(name string, labelValues ...string) string {
+	parts := []string{name}
+	for _, value := range labelValues {
+		value = strings.Trim(metricsInvalidNameChars.ReplaceAllString(value, "_"), "_")
+		if value == "" {
+			value = "root"
+		}
+
+		parts = append(parts, value)
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// metricsRoute names the `mux` pattern for metricName, the rooted subtree
+// patterns getting a "subtree" suffix, e.g. "/blocks/" gives
+// "/blocks/subtree", so they stay apart from the exact paths, e.g. "/blocks".
+func metricsRoute(pattern string) string {
+	if pattern == "" {
+		return metricsRouteUnmatched
+	}
+
+	if pattern != "/" && strings.HasSuffix(pattern, "/") {
+		return pattern + "subtree"
+	}
+
+	return pattern
+}
+
+// metricsMethod is the `method` of a request, or metricsMethodOther.
+func metricsMethod(method string) string {
+	if !metricsMethods[method] {
+		return metricsMethodOther
+	}
+
+	return method
+}
+
+// countSyncError counts a failed or invalid sync response of the Peer at
+// `tcpAddress`.
+func (m *nodeMetrics) countSyncError(tcpAddress string) {
+	metrics.GetOrRegisterCounter(metricName("sb/sync/errors", tcpAddress), m.registry).Inc(1)
+}
+
+// instrument counts and times the requests served by `next`, labelled by
+// the `mux` pattern they match.
+func (m *nodeMetrics) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		route := metricsRoute(pattern)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		requests := metricName("sb/http/requests", route, metricsMethod(r.Method), strconv.Itoa(recorder.status))
+		metrics.GetOrRegisterCounter(requests, m.registry).Inc(1)
+		metrics.GetOrRegisterTimer(metricName("sb/http/request/duration", route), m.registry).UpdateSince(start)
+	})
+}
+
+// statusRecorder remembers the status code written to the ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets the WebSocket upgrade take over the connection.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support hijacking")
+	}
+
+	sr.status = http.StatusSwitchingProtocols
+
+	return hijacker.Hijack()
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet) {
+		return
+	}
+
+	prometheus.Handler(node.metrics.registry).ServeHTTP(w, r)
+}
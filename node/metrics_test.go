@@ -0,0 +1,210 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+
+	peer := NewPeerNode("127.0.0.1", 8086, false, database.NewAccount(""), true)
+	n.knownPeers[peer.TcpAddress()] = peer
+	n.penalizePeer(peer, fmt.Errorf("timeout"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpointTx, func(w http.ResponseWriter, r *http.Request) {
+		txStatusHandler(w, r, n)
+	})
+	mux.HandleFunc(endpointMetrics, func(w http.ResponseWriter, r *http.Request) {
+		metricsHandler(w, r, n)
+	})
+	handler := n.metrics.instrument(mux, mux)
+
+	for _, path := range []string{endpointTx + "nope", endpointTx + "nope", "/unknown/random"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Custom methods share a single series
+	for _, method := range []string{"PROPFIND", "FOO", "BAR"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, endpointTx+"nope", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, endpointMetrics, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("metrics should be served, got %d", rec.Code)
+	}
+
+	assertTestMetrics(t, rec.Body.String(),
+		"sb_http_requests_tx_subtree_GET_400 2",
+		"sb_http_requests_tx_subtree_other_405 3",
+		"sb_http_requests_unmatched_GET_404 1",
+		"sb_http_request_duration_tx_subtree_count 5",
+		"sb_sync_errors_127_0_0_1_8086 1",
+		"sb_chain_height 0",
+		"sb_mempool_txs 0",
+		"sb_peers_known 1",
+		"sb_peers_connected 1",
+		"sb_miner_attempts_total 0",
+	)
+}
+
+func TestMetricsHandler_KeepsRoutesApart(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpointBlocks, func(w http.ResponseWriter, r *http.Request) {
+		blocksHandler(w, r, n)
+	})
+	mux.HandleFunc(endpointBlock, func(w http.ResponseWriter, r *http.Request) {
+		blockHandler(w, r, n)
+	})
+	mux.HandleFunc(endpointMetrics, func(w http.ResponseWriter, r *http.Request) {
+		metricsHandler(w, r, n)
+	})
+	handler := n.metrics.instrument(mux, mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, endpointBlocks, nil))
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, endpointBlock+"nope", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, endpointMetrics, nil))
+
+	assertTestMetrics(t, rec.Body.String(),
+		"sb_http_request_duration_blocks_count 1",
+		"sb_http_request_duration_blocks_subtree_count 2",
+	)
+}
+
+func TestMetricName(t *testing.T) {
+	cases := map[string]string{
+		metricName("sb/http/requests", "/tx/add", "GET", "200"):  "sb/http/requests/tx_add/GET/200",
+		metricName("sb/http/requests", "/", "GET", "200"):        "sb/http/requests/root/GET/200",
+		metricName("sb/sync/errors", "[::1]:8080"):               "sb/sync/errors/1_8080",
+		metricName("sb/http/requests", metricsRoute("/blocks")):  "sb/http/requests/blocks",
+		metricName("sb/http/requests", metricsRoute("/blocks/")): "sb/http/requests/blocks_subtree",
+		metricName("sb/http/requests", metricsRoute("")):         "sb/http/requests/unmatched",
+	}
+
+	for name, expected := range cases {
+		if name != expected {
+			t.Fatalf("metric name should be '%s', got '%s'", expected, name)
+		}
+	}
+}
+
+func TestNode_AddBlockTimesBlockApply(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithConsensus(
+		t,
+		map[common.Address]uint{sender: 1000},
+		database.ConsensusConfig{Engine: consensus.EngineDev})
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.minePendingTXs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest(http.MethodGet, endpointMetrics, nil), n)
+
+	assertTestMetrics(t, rec.Body.String(),
+		"sb_block_apply_duration_count 1",
+		"sb_chain_height 0",
+	)
+}
+
+func TestNode_RunServesMetrics(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(newTestConfig(dataDir, "127.0.0.1", 8091, database.NewAccount(DefaultMiner), []PeerNode{}), logger.Discard())
+	url := fmt.Sprintf("http://%s", n.info.TcpAddress())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- n.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	var res *http.Response
+	for i := 0; i < 100; i++ {
+		res, err = http.Get(url + endpointHealthz)
+		if err == nil {
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = http.Get(url + endpointMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every request goes through the instrumented handler chain
+	assertTestMetrics(t, string(body),
+		"sb_http_requests_healthz_GET_200 1",
+		"sb_http_request_duration_healthz_count 1",
+		"sb_peers_known 0",
+	)
+}
+
+func assertTestMetrics(t *testing.T, body string, expected ...string) {
+	t.Helper()
+
+	for _, metric := range expected {
+		if !strings.Contains(body, metric+"\n") {
+			t.Fatalf("metrics should contain '%s', got:\n%s", metric, body)
+		}
+	}
+}
@@ -3,12 +3,13 @@ package node
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
 	"github.com/simone-trubian/blockchain-tutorial/database"
-	"github.com/simone-trubian/blockchain-tutorial/fs"
 )
 
 type PendingBlock struct {
@@ -27,63 +28,28 @@ func NewPendingBlock(
 	return PendingBlock{parent, number, uint64(time.Now().Unix()), miner, txs}
 }
 
-func Mine(ctx context.Context, pb PendingBlock) (database.Block, error) {
-	if len(pb.txs) == 0 {
-		return database.Block{}, fmt.Errorf("mining empty blocks is not allowed")
-	}
-
-	start := time.Now()
-	attempt := 0
-	var block database.Block
-	var hash database.Hash
-	var nonce uint32
-
-	for !database.IsBlockHashValid(hash) {
-		select {
-		case <-ctx.Done():
-			fmt.Println("Mining cancelled!")
-
-			return database.Block{}, fmt.Errorf("mining cancelled. %s", ctx.Err())
-		default:
-		}
-
-		attempt++
-		nonce = generateNonce()
-
-		if attempt%1000000 == 0 || attempt == 1 {
-			fmt.Printf(
-				"Mining %d Pending TXs. Attempt: %d\n", len(pb.txs), attempt)
-		}
-
-		block = database.NewBlock(
-			pb.parent, pb.number, nonce, pb.time, pb.miner, pb.txs)
-		blockHash, err := block.Hash()
-		if err != nil {
-			return database.Block{}, fmt.Errorf(
-				"couldn't mine block. %s", err.Error())
-		}
-
-		hash = blockHash
-	}
-
-	fmt.Printf(
-		"\nMined new Block '%x' using PoW🎉🎉🎉%s:\n",
-		hash,
-		fs.Unicode("\\U1F389"))
-	fmt.Printf("\tHeight: '%v'\n", block.Header.Number)
-	fmt.Printf("\tNonce: '%v'\n", block.Header.Nonce)
-	fmt.Printf("\tCreated: '%v'\n", block.Header.Time)
-	fmt.Printf("\tMiner: '%v'\n", block.Header.Miner.String())
-	fmt.Printf("\tParent: '%v'\n\n", block.Header.Parent.Hex())
-
-	fmt.Printf("\tAttempt: '%v'\n", attempt)
-	fmt.Printf("\tTime: %s\n\n", time.Since(start))
+// NewPendingBlockFromWork rebuilds the block template handed out to an
+// external miner.
+func NewPendingBlockFromWork(work MiningWorkRes) PendingBlock {
+	return PendingBlock{work.Parent, work.Number, work.Time, work.Miner, work.TXs}
+}
 
-	return block, nil
+// block builds the block of the pending TXs with the `nonce`.
+func (pb PendingBlock) block(nonce uint32) database.Block {
+	return database.NewBlock(pb.parent, pb.number, nonce, pb.time, pb.miner, pb.txs)
 }
 
-func generateNonce() uint32 {
-	rand.Seed(time.Now().UTC().UnixNano())
+// Mine searches the PoW nonce of the `pb` block with `threads` goroutines,
+// all of them if not positive, counting every hash computed into `attempts`.
+func Mine(
+	ctx context.Context,
+	pb PendingBlock,
+	threads int,
+	attempts metrics.Counter,
+	logger log.Logger) (database.Block, error) {
+	if len(pb.txs) == 0 {
+		return database.Block{}, fmt.Errorf("mining empty blocks is not allowed")
+	}
 
-	return rand.Uint32()
+	return consensus.NewPoW(threads, attempts, logger).Seal(ctx, pb.block(0))
 }
@@ -5,41 +5,18 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"encoding/hex"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
 	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
 	"github.com/simone-trubian/blockchain-tutorial/wallet"
 )
 
-func TestValidBlockHash(t *testing.T) {
-	hexHash := "000000fa04f8160395c387277f8b2f14837603383d33809a4db586086168edfa"
-	var hash = database.Hash{}
-
-	hex.Decode(hash[:], []byte(hexHash))
-
-	isValid := database.IsBlockHashValid(hash)
-	if !isValid {
-		t.Fatalf(
-			"hash '%s' starting with 6 zeroes is suppose to be valid", hexHash)
-	}
-}
-
-func TestInvalidBlockHash(t *testing.T) {
-	hexHash := "000001fa04f8160395c387277f8b2f14837603383d33809a4db586086168edfa"
-	var hash = database.Hash{}
-
-	hex.Decode(hash[:], []byte(hexHash))
-
-	isValid := database.IsBlockHashValid(hash)
-	if isValid {
-		t.Fatal("hash is not suppose to be valid")
-	}
-}
-
 func TestMine(t *testing.T) {
 	minerPrivKey, _, miner, err := generateKey()
 	if err != nil {
@@ -52,18 +29,23 @@ func TestMine(t *testing.T) {
 	}
 
 	ctx := context.Background()
+	attempts := metrics.NewCounterForced()
 
-	minedBlock, err := Mine(ctx, pendingBlock)
+	minedBlock, err := Mine(ctx, pendingBlock, 0, attempts, logger.Discard())
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if attempts.Count() < 1 {
+		t.Fatal("every mining attempt should be counted")
+	}
+
 	minedBlockHash, err := minedBlock.Hash()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !database.IsBlockHashValid(minedBlockHash) {
+	if !consensus.IsBlockHashValid(minedBlockHash) {
 		t.Fatal()
 	}
 
@@ -83,12 +65,65 @@ func TestMineWithTimeout(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), time.Microsecond*100)
+	ctx, _ := context.WithTimeout(context.Background(), time.Millisecond*50)
+	attempts := metrics.NewCounterForced()
 
-	_, err = Mine(ctx, pendingBlock)
+	_, err = Mine(ctx, pendingBlock, 4, attempts, logger.Discard())
 	if err == nil {
 		t.Fatal(err)
 	}
+
+	if attempts.Count() < 1 {
+		t.Fatal("attempts of every mining thread should be counted once cancelled")
+	}
+}
+
+func TestNode_MinePendingTXsWithConsensus(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithConsensus(
+		t,
+		map[common.Address]uint{sender: 1000},
+		database.ConsensusConfig{Engine: consensus.EngineDev})
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devEngine := n.consensus
+
+	// The sender isn't the signer of the first block
+	n.consensus, err = consensus.NewPoA([]common.Address{n.minerAccount()}, senderPrivKey, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.minePendingTXs(context.Background())
+	if err != nil || n.state.NextBlockNumber() != 0 {
+		t.Fatalf("node should wait for the signer in turn, got %v", err)
+	}
+
+	n.consensus = devEngine
+
+	err = n.minePendingTXs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.state.NextBlockNumber() != 1 || len(n.pendingTXs) != 0 {
+		t.Fatal("dev engine should seal the pending TXs at once")
+	}
 }
 
 func generateKey() (*ecdsa.PrivateKey, ecdsa.PublicKey, common.Address, error) {
@@ -0,0 +1,209 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/client"
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const endpointMiningWork = "/mining/work"
+const endpointMiningWorkQueryKeyMiner = "miner"
+
+const endpointMiningSubmit = "/mining/submit"
+
+// maxMiningWork is how many block templates are kept for the external
+// miners to submit, the oldest are forgotten first.
+const maxMiningWork = 64
+
+// The mining work request and response types shared with the Go SDK.
+type MiningWorkRes = client.MiningWorkRes
+type MiningSubmitReq = client.MiningSubmitReq
+type MiningSubmitRes = client.MiningSubmitRes
+
+func miningWorkHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet) {
+		return
+	}
+
+	miner := common.Address{}
+
+	minerRaw := r.URL.Query().Get(endpointMiningWorkQueryKeyMiner)
+	if minerRaw != "" {
+		if !common.IsHexAddress(minerRaw) {
+			writeErrRes(w, newBadReqErr(fmt.Errorf("invalid miner '%s'", minerRaw)))
+			return
+		}
+
+		miner = common.HexToAddress(minerRaw)
+	}
+
+	work, err := node.newMiningWork(miner)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, work)
+}
+
+func miningSubmitHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodPost) {
+		return
+	}
+
+	req := MiningSubmitReq{}
+	err := readReq(r, &req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	res, err := node.submitMiningWork(req.ID, req.Nonce)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, res)
+}
+
+// newMiningWork hands out a block template of the pending TXs on top of the
+// latest block, crediting the reward to `miner` or to the node miner.
+//
+// The template is identified by its hash with a zero nonce, so the miners
+// asking for the same work get the same template.
+func (n *Node) newMiningWork(miner common.Address) (MiningWorkRes, error) {
+	if _, isPoW := n.consensus.(*consensus.PoW); !isPoW {
+		return MiningWorkRes{}, statusErr{
+			http.StatusNotImplemented, fmt.Errorf("the chain blocks are not sealed by PoW mining")}
+	}
+
+	if n.pendingTXsCount() == 0 {
+		return MiningWorkRes{}, statusErr{
+			http.StatusServiceUnavailable, fmt.Errorf("there are no pending TXs to mine")}
+	}
+
+	if miner == (common.Address{}) {
+		miner = n.minerAccount()
+	}
+
+	pb := NewPendingBlock(
+		n.state.LatestBlockHash(),
+		n.state.NextBlockNumber(),
+		miner,
+		n.getPendingTXsAsArray(),
+	)
+
+	id, err := pb.block(0).Hash()
+	if err != nil {
+		return MiningWorkRes{}, err
+	}
+
+	n.miningWorkMu.Lock()
+	n.forgetStaleMiningWork(pb.parent)
+	n.miningWork[id] = pb
+	n.miningWorkMu.Unlock()
+
+	n.minerLogger.Debug("Handed out mining work", "id", id.Hex(), "number", pb.number, "txs", len(pb.txs))
+
+	return MiningWorkRes{
+		ID:     id,
+		Parent: pb.parent,
+		Number: pb.number,
+		Time:   pb.time,
+		Miner:  pb.miner,
+		TXs:    pb.txs,
+		Target: consensus.BlockHashTarget(),
+	}, nil
+}
+
+// submitMiningWork seals the `id` template with the `nonce` found by an
+// external miner and adds the block to the chain.
+func (n *Node) submitMiningWork(id database.Hash, nonce uint32) (MiningSubmitRes, error) {
+	n.miningWorkMu.Lock()
+	defer n.miningWorkMu.Unlock()
+
+	pb, isKnown := n.miningWork[id]
+	if !isKnown {
+		return MiningSubmitRes{}, statusErr{
+			http.StatusNotFound, fmt.Errorf("mining work '%s' is unknown or expired", id.Hex())}
+	}
+
+	if pb.parent != n.state.LatestBlockHash() {
+		delete(n.miningWork, id)
+
+		return MiningSubmitRes{}, statusErr{
+			http.StatusConflict,
+			fmt.Errorf("mining work '%s' is stale, block %d was already added", id.Hex(), pb.number)}
+	}
+
+	block := pb.block(nonce)
+	hash, err := block.Hash()
+	if err != nil {
+		return MiningSubmitRes{}, err
+	}
+
+	err = n.consensus.VerifyHeader(block.Header, hash)
+	if err != nil {
+		return MiningSubmitRes{}, newBadReqErr(
+			fmt.Errorf("nonce %d doesn't solve mining work '%s'. %s", nonce, id.Hex(), err.Error()))
+	}
+
+	// The State re-checks the parent while adding the block, the miner or
+	// the sync might have added another block since the check above
+	err = n.addBlock(block)
+	if errors.Is(err, database.ErrBlockNotNext) {
+		delete(n.miningWork, id)
+
+		return MiningSubmitRes{}, statusErr{
+			http.StatusConflict,
+			fmt.Errorf("mining work '%s' is stale. %s", id.Hex(), err.Error())}
+	}
+	if err != nil {
+		return MiningSubmitRes{}, err
+	}
+
+	n.removeMinedPendingTXs(block)
+
+	// Every template built on the previous block is now stale, and so is
+	// the block being mined by the node
+	n.forgetStaleMiningWork(hash)
+	n.abandonCurrentMining()
+
+	n.minerLogger.Info(
+		"Added block mined by an external miner",
+		"number", block.Header.Number,
+		"hash", hash.Hex(),
+		"miner", block.Header.Miner.String())
+
+	return MiningSubmitRes{Hash: hash, Number: block.Header.Number}, nil
+}
+
+// forgetStaleMiningWork forgets the templates not built on the `latest`
+// block and the oldest ones over maxMiningWork. The caller holds
+// miningWorkMu.
+func (n *Node) forgetStaleMiningWork(latest database.Hash) {
+	for id, pb := range n.miningWork {
+		if pb.parent != latest {
+			delete(n.miningWork, id)
+		}
+	}
+
+	for len(n.miningWork) >= maxMiningWork {
+		oldestId := database.Hash{}
+		oldestTime := ^uint64(0)
+
+		for id, pb := range n.miningWork {
+			if pb.time < oldestTime {
+				oldestId, oldestTime = id, pb.time
+			}
+		}
+
+		delete(n.miningWork, oldestId)
+	}
+}
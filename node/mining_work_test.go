@@ -0,0 +1,203 @@
+package node
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+func TestMiningWorkHandler(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithState(t, map[common.Address]uint{sender: 1000})
+
+	sendTestAdminReq(t, n, miningWorkHandler, http.MethodGet, endpointMiningWork, nil, http.StatusServiceUnavailable, nil)
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work := MiningWorkRes{}
+	sendTestAdminReq(t, n, miningWorkHandler, http.MethodGet, endpointMiningWork, nil, http.StatusOK, &work)
+
+	if work.Parent != n.state.LatestBlockHash() ||
+		work.Number != n.state.NextBlockNumber() ||
+		work.Miner != n.minerAccount() ||
+		len(work.TXs) != 1 ||
+		work.Target != consensus.BlockHashTarget() {
+		t.Fatalf("work should be the next block of the pending TXs, got %+v", work)
+	}
+
+	id, err := NewPendingBlockFromWork(work).block(0).Hash()
+	if err != nil || id != work.ID {
+		t.Fatalf("work ID should be its hash with a zero nonce, got %s", work.ID.Hex())
+	}
+
+	miner := database.NewAccount(testKsSimoneAccount)
+	minerWork := MiningWorkRes{}
+	sendTestAdminReq(t, n, miningWorkHandler, http.MethodGet, endpointMiningWork+"?miner="+miner.Hex(), nil, http.StatusOK, &minerWork)
+
+	if minerWork.Miner != miner || minerWork.ID == work.ID {
+		t.Fatalf("work should credit the requested miner, got %+v", minerWork)
+	}
+
+	sendTestAdminReq(t, n, miningWorkHandler, http.MethodGet, endpointMiningWork+"?miner=simone", nil, http.StatusBadRequest, nil)
+
+	n.consensus = consensus.NewDev(logger.Discard())
+	sendTestAdminReq(t, n, miningWorkHandler, http.MethodGet, endpointMiningWork, nil, http.StatusNotImplemented, nil)
+}
+
+func TestMiningSubmitHandler(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithState(t, map[common.Address]uint{sender: 1000})
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work, err := n.newMiningWork(common.Address{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendTestAdminReq(t, n, miningSubmitHandler, http.MethodPost, endpointMiningSubmit,
+		MiningSubmitReq{ID: database.Hash{1}}, http.StatusNotFound, nil)
+
+	// Finding a valid nonce takes too long, any invalid one will do
+	invalidNonce := uint32(0)
+	pb := NewPendingBlockFromWork(work)
+	for {
+		hash, err := pb.block(invalidNonce).Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !consensus.IsBlockHashValid(hash) {
+			break
+		}
+		invalidNonce++
+	}
+
+	sendTestAdminReq(t, n, miningSubmitHandler, http.MethodPost, endpointMiningSubmit,
+		MiningSubmitReq{ID: work.ID, Nonce: invalidNonce}, http.StatusBadRequest, nil)
+
+	if n.state.NextBlockNumber() != work.Number || len(n.pendingTXs) != 1 {
+		t.Fatal("invalid nonce should leave the chain and the mempool untouched")
+	}
+
+	staleWork := pb
+	staleWork.parent = database.Hash{2}
+	n.miningWork[database.Hash{3}] = staleWork
+
+	sendTestAdminReq(t, n, miningSubmitHandler, http.MethodPost, endpointMiningSubmit,
+		MiningSubmitReq{ID: database.Hash{3}}, http.StatusConflict, nil)
+
+	if _, isKept := n.miningWork[database.Hash{3}]; isKept {
+		t.Fatal("stale work should be forgotten")
+	}
+}
+
+func TestMiningSubmitHandler_BlockAddedMeanwhile(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Any nonce seals a Dev block
+	n := newTestNodeWithConsensus(
+		t, map[common.Address]uint{sender: 1000}, database.ConsensusConfig{Engine: consensus.EngineDev})
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""),
+		senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.AddPendingTX(signedTx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.addBlock(NewPendingBlock(database.Hash{}, 0, n.minerAccount(), nil).block(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent still matches, as if the State moved on right after the
+	// check and the block number is now taken
+	takenWork := NewPendingBlock(
+		n.state.LatestBlockHash(), n.state.NextBlockNumber()+1, n.minerAccount(), n.getPendingTXsAsArray())
+	n.miningWork[database.Hash{1}] = takenWork
+
+	sendTestAdminReq(t, n, miningSubmitHandler, http.MethodPost, endpointMiningSubmit,
+		MiningSubmitReq{ID: database.Hash{1}}, http.StatusConflict, nil)
+
+	if n.state.NextBlockNumber() != 1 || len(n.pendingTXs) != 1 {
+		t.Fatal("a block not added should leave the chain and the mempool untouched")
+	}
+
+	work := NewPendingBlock(
+		n.state.LatestBlockHash(), n.state.NextBlockNumber(), n.minerAccount(), n.getPendingTXsAsArray())
+	n.miningWork[database.Hash{2}] = work
+
+	res := MiningSubmitRes{}
+	sendTestAdminReq(t, n, miningSubmitHandler, http.MethodPost, endpointMiningSubmit,
+		MiningSubmitReq{ID: database.Hash{2}}, http.StatusOK, &res)
+
+	if res.Hash != n.state.LatestBlockHash() || len(n.pendingTXs) != 0 {
+		t.Fatal("the added block TXs should leave the mempool")
+	}
+}
+
+func TestNode_ForgetStaleMiningWork(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	latest := database.Hash{1}
+
+	n.miningWork[database.Hash{2}] = PendingBlock{parent: database.Hash{9}}
+	for i := 0; i < maxMiningWork; i++ {
+		n.miningWork[database.Hash{3, byte(i)}] = PendingBlock{parent: latest, time: uint64(100 + i)}
+	}
+
+	n.forgetStaleMiningWork(latest)
+
+	if len(n.miningWork) != maxMiningWork-1 {
+		t.Fatalf("work over the limit should be forgotten, %d kept", len(n.miningWork))
+	}
+
+	if _, isKept := n.miningWork[database.Hash{2}]; isKept {
+		t.Fatal("work on another parent should be forgotten")
+	}
+
+	if _, isKept := n.miningWork[database.Hash{3, 0}]; isKept {
+		t.Fatal("oldest work should be forgotten first")
+	}
+}
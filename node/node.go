@@ -2,80 +2,226 @@ package node
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/simone-trubian/blockchain-tutorial/client"
+	"github.com/simone-trubian/blockchain-tutorial/consensus"
 	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
 	"github.com/simone-trubian/blockchain-tutorial/wallet"
 )
 
 const DefaultBootstrapIp = "node.sb.web3.coach"
 const DefaultBootstrapPort = 8080
-const DefaultBootstrapAcc = wallet.SimoneAccount
 const DefaultMiner = "0x0000000000000000000000000000000000000000"
 const DefaultIP = "127.0.0.1"
 const DefaultHTTPort = 8080
 const endpointStatus = "/node/status"
 
+const endpointTx = "/tx/"
+
+const endpointBlocks = "/blocks"
+const endpointBlocksQueryKeyFrom = "from"
+const endpointBlocksQueryKeyTo = "to"
+const endpointBlock = "/blocks/"
+const endpointBlockLatest = "latest"
+const endpointBlockByHash = "hash/"
+
+// blocksMaxRange caps how many blocks a single /blocks query returns.
+const blocksMaxRange = 100
+
 const endpointSync = "/node/sync"
 const endpointSyncQueryKeyFromBlock = "fromBlock"
+const endpointSyncQueryKeyLimit = "limit"
+
+// syncMaxBlocksPerPage caps how many blocks a single /node/sync response
+// carries, so neither side has to hold the whole chain in memory.
+const syncMaxBlocksPerPage = 500
+
+const endpointHeaders = "/node/headers"
+
+// syncBlocksPerDownload is how many blocks are requested from a single peer
+// at once while downloading block bodies in parallel.
+const syncBlocksPerDownload = 50
+
+// syncMaxParallelDownloads caps how many peers serve block bodies at once.
+const syncMaxParallelDownloads = 4
 
 const endpointAddPeer = "/node/peer"
 const endpointAddPeerQueryKeyIP = "ip"
 const endpointAddPeerQueryKeyPort = "port"
-const endpointAddPeerQueryKeyMiner = "miner"
+const endpointAddPeerQueryKeyAccount = "account"
+const endpointAddPeerQueryKeyChallenge = "challenge"
+const endpointAddPeerQueryKeySig = "sig"
+const endpointAddPeerQueryKeyTLS = "tls"
 
-const miningIntervalSeconds = 10
+const endpointHandshake = "/node/handshake"
+const endpointHandshakeQueryKeyChallenge = "challenge"
+const endpointHandshakeQueryKeyIP = "ip"
+const endpointHandshakeQueryKeyPort = "port"
 
 type PeerNode struct {
 	IP          string         `json:"ip"`
 	Port        uint64         `json:"port"`
 	IsBootstrap bool           `json:"is_bootstrap"`
 	Account     common.Address `json:"account"`
+	TLS         bool           `json:"tls"`
 
 	// Whenever my node already established connection, sync with this Peer
 	connected bool
+
+	// Drops whenever the Peer misbehaves, see penalizePeer()
+	score int
 }
 
 func (pn PeerNode) TcpAddress() string {
 	return fmt.Sprintf("%s:%d", pn.IP, pn.Port)
 }
 
+func (pn PeerNode) ApiProtocol() string {
+	if pn.TLS {
+		return "https"
+	}
+
+	return "http"
+}
+
+// Url builds the URL of the Peer `endpoint`, dialing HTTPS if the Peer
+// advertises TLS.
+func (pn PeerNode) Url(endpoint string) string {
+	return fmt.Sprintf("%s://%s%s", pn.ApiProtocol(), pn.TcpAddress(), endpoint)
+}
+
 type Node struct {
 	dataDir string
 	info    PeerNode
+	nodeKey *ecdsa.PrivateKey
+
+	// The miner settings can be changed by the admin while mining
+	miningMu      sync.RWMutex
+	miner         common.Address
+	miningEnabled bool
+	// Signals the miner to abandon the block being mined
+	miningAbandoned chan struct{}
+
+	// The block templates handed out to the external miners by their ID
+	miningWorkMu sync.Mutex
+	miningWork   map[database.Hash]PendingBlock
+
+	state     *database.State
+	consensus consensus.Consensus
+
+	// The Peers are updated by the sync and the HTTP handlers at once
+	peersMu     sync.RWMutex
+	knownPeers  map[string]PeerNode
+	bannedPeers map[string]BannedPeer
+
+	// The Mempool is updated by the sync, the miner and the HTTP handlers
+	mempoolMu   sync.RWMutex
+	pendingTXs  map[string]database.SignedTx
+	archivedTXs map[string]database.SignedTx
 
-	state           *database.State
-	knownPeers      map[string]PeerNode
-	pendingTXs      map[string]database.SignedTx
-	archivedTXs     map[string]database.SignedTx
 	newSyncedBlocks chan database.Block
 	newPendingTXs   chan database.SignedTx
 	isMining        bool
+	peerBanDuration time.Duration
+	tls             TLSConfig
+	peerClient      *http.Client
+	acceptPeers     bool
+	adminToken      string
+
+	handshakeMu         sync.Mutex
+	handshakeChallenges map[string]time.Time
+
+	wsHub    *wsHub
+	webhooks *webhookDispatcher
+	metrics  *nodeMetrics
+
+	syncProgress         syncProgress
+	readyMaxBlocksBehind uint64
+	miningInterval       time.Duration
+	miningThreads        int
+	syncInterval         time.Duration
+	shutdownTimeout      time.Duration
+	readTimeout          time.Duration
+	writeTimeout         time.Duration
+	maxBodyBytes         int64
+	rateLimiter          *rateLimiter
+	cors                 CORSConfig
+
+	logger      log.Logger
+	dbLogger    log.Logger
+	syncLogger  log.Logger
+	minerLogger log.Logger
+	httpLogger  log.Logger
+	peersLogger log.Logger
 }
 
-func New(
-	dataDir string,
-	ip string,
-	port uint64,
-	acc common.Address,
-	bootstrap PeerNode) *Node {
+func New(cfg Config, nodeLogger log.Logger) *Node {
 	knownPeers := make(map[string]PeerNode)
-	knownPeers[bootstrap.TcpAddress()] = bootstrap
+	for _, bootstrap := range cfg.Bootstraps {
+		knownPeers[bootstrap.TcpAddress()] = bootstrap
+	}
+
+	info := NewPeerNode(cfg.IP, cfg.Port, false, common.Address{}, true)
+	info.TLS = cfg.TLS.Enabled
 
-	return &Node{
-		dataDir:         dataDir,
-		info:            NewPeerNode(ip, port, false, acc, true),
+	httpLogger := logger.ForSubsystem(nodeLogger, logger.SubsystemHttp)
+
+	n := &Node{
+		dataDir:         cfg.DataDir,
+		info:            info,
+		miner:           cfg.Miner,
+		miningEnabled:   true,
+		miningAbandoned: make(chan struct{}, 1),
+		miningWork:      make(map[database.Hash]PendingBlock),
 		knownPeers:      knownPeers,
 		pendingTXs:      make(map[string]database.SignedTx),
 		archivedTXs:     make(map[string]database.SignedTx),
 		newSyncedBlocks: make(chan database.Block),
 		newPendingTXs:   make(chan database.SignedTx, 10000),
 		isMining:        false,
+		bannedPeers:     make(map[string]BannedPeer),
+		peerBanDuration: cfg.PeerBanDuration,
+		tls:             cfg.TLS,
+		peerClient:      newPeerHTTPClient(nil),
+		acceptPeers:     cfg.AcceptPeers,
+		adminToken:      cfg.AdminToken,
+
+		handshakeChallenges: make(map[string]time.Time),
+
+		wsHub:    newWsHub(httpLogger),
+		webhooks: newWebhookDispatcher(cfg.Webhooks, httpLogger),
+
+		readyMaxBlocksBehind: cfg.ReadyMaxBlocksBehind,
+		miningInterval:       cfg.MiningInterval,
+		miningThreads:        cfg.MiningThreads,
+		syncInterval:         cfg.SyncInterval,
+		shutdownTimeout:      cfg.ShutdownTimeout,
+		readTimeout:          cfg.ReadTimeout,
+		writeTimeout:         cfg.WriteTimeout,
+		maxBodyBytes:         cfg.MaxBodyBytes,
+		rateLimiter:          newRateLimiter(cfg.RateLimit, cfg.RouteRateLimits),
+		cors:                 cfg.CORS,
+
+		logger:      logger.ForSubsystem(nodeLogger, logger.SubsystemNode),
+		dbLogger:    logger.ForSubsystem(nodeLogger, logger.SubsystemDb),
+		syncLogger:  logger.ForSubsystem(nodeLogger, logger.SubsystemSync),
+		minerLogger: logger.ForSubsystem(nodeLogger, logger.SubsystemMiner),
+		httpLogger:  httpLogger,
+		peersLogger: logger.ForSubsystem(nodeLogger, logger.SubsystemPeers),
 	}
+	n.metrics = newNodeMetrics(n)
+
+	return n
 }
 
 func NewPeerNode(
@@ -84,26 +230,111 @@ func NewPeerNode(
 	isBootstrap bool,
 	acc common.Address,
 	connected bool) PeerNode {
-	return PeerNode{ip, port, isBootstrap, acc, connected}
+	return PeerNode{ip, port, isBootstrap, acc, false, connected, 0}
+}
+
+// newPeerNodeFromClient builds a not yet connected PeerNode from a Peer
+// advertised by another node.
+func newPeerNodeFromClient(peer client.Peer) PeerNode {
+	return PeerNode{peer.IP, peer.Port, peer.IsBootstrap, peer.Account, peer.TLS, false, 0}
+}
+
+func (pn PeerNode) clientPeer() client.Peer {
+	return client.Peer{
+		IP:          pn.IP,
+		Port:        pn.Port,
+		IsBootstrap: pn.IsBootstrap,
+		Account:     pn.Account,
+		TLS:         pn.TLS,
+	}
+}
+
+// apiClient builds the Go SDK client calling the Peer through `httpClient`.
+func (pn PeerNode) apiClient(httpClient *http.Client) *client.Client {
+	return client.New(pn.Url(""), httpClient)
 }
 
+// Run serves the node until the `ctx` is cancelled, then stops gracefully:
+// the HTTP server stops accepting requests, the sync and the miner are
+// cancelled and awaited, and the mempool and state are flushed to disk.
 func (n *Node) Run(ctx context.Context) error {
-	fmt.Printf("Listening on: %s:%d", n.info.IP, n.info.Port)
+	nodeKey, err := wallet.LoadOrCreateNodeKey(n.dataDir)
+	if err != nil {
+		return err
+	}
 
-	state, err := database.NewStateFromDisk(n.dataDir)
+	n.nodeKey = nodeKey
+	n.info.Account = crypto.PubkeyToAddress(nodeKey.PublicKey)
+
+	n.logger.Info("Loaded node key", "account", n.info.Account.String())
+
+	genesis, err := database.LoadGenesis(n.dataDir)
 	if err != nil {
 		return err
 	}
-	defer state.Close()
+
+	// The PoA signers are the node accounts, sealing with their node key
+	n.consensus, err = consensus.New(genesis.Consensus, consensus.Options{
+		Threads:   n.miningThreads,
+		Attempts:  n.metrics.minerAttempts,
+		SignerKey: nodeKey,
+		Logger:    n.minerLogger,
+	})
+	if err != nil {
+		return err
+	}
+
+	engine := genesis.Consensus.Engine
+	if engine == "" {
+		engine = consensus.EnginePoW
+	}
+	n.logger.Info("Loaded consensus engine", "engine", engine)
+
+	state, err := database.NewStateFromDisk(n.dataDir, n.consensus, n.dbLogger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := state.Close()
+		if err != nil {
+			n.dbLogger.Error("Unable to close the state", "err", err)
+		}
+	}()
 
 	n.state = state
 
-	fmt.Println("Blockchain state:")
-	fmt.Printf("	- height: %d\n", n.state.LatestBlock().Header.Number)
-	fmt.Printf("	- hash: %s\n", n.state.LatestBlockHash().Hex())
+	bannedPeers, err := LoadBannedPeers(n.dataDir)
+	if err != nil {
+		return err
+	}
+	n.bannedPeers = bannedPeers
 
-	go n.sync(ctx)
-	go n.mine(ctx)
+	storedPeers, err := LoadKnownPeers(n.dataDir)
+	if err != nil {
+		return err
+	}
+
+	for _, peer := range storedPeers {
+		if !n.IsKnownPeer(peer) {
+			n.knownPeers[peer.TcpAddress()] = peer
+		}
+	}
+
+	for _, peer := range n.knownPeers {
+		if n.IsBannedPeer(peer) {
+			n.RemovePeer(peer)
+		}
+	}
+
+	n.logger.Info(
+		"Loaded blockchain state",
+		"height", n.state.LatestBlock().Header.Number,
+		"hash", n.state.LatestBlockHash().Hex())
+
+	err = n.restoreMempool()
+	if err != nil {
+		return err
+	}
 
 	handler := http.NewServeMux()
 
@@ -115,6 +346,50 @@ func (n *Node) Run(ctx context.Context) error {
 		txAddHandler(w, r, n)
 	})
 
+	handler.HandleFunc("/tx/submit", func(w http.ResponseWriter, r *http.Request) {
+		txSubmitHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointTx, func(w http.ResponseWriter, r *http.Request) {
+		txStatusHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointBlocks, func(w http.ResponseWriter, r *http.Request) {
+		blocksHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointBlock, func(w http.ResponseWriter, r *http.Request) {
+		blockHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointMiningWork, func(w http.ResponseWriter, r *http.Request) {
+		miningWorkHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointMiningSubmit, func(w http.ResponseWriter, r *http.Request) {
+		miningSubmitHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointWS, func(w http.ResponseWriter, r *http.Request) {
+		wsHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointOpenAPI, openAPIHandler)
+
+	handler.HandleFunc(endpointHealthz, healthzHandler)
+
+	handler.HandleFunc(endpointReadyz, func(w http.ResponseWriter, r *http.Request) {
+		readyzHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointMetrics, func(w http.ResponseWriter, r *http.Request) {
+		metricsHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointRPC, func(w http.ResponseWriter, r *http.Request) {
+		rpcHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointStatus, func(w http.ResponseWriter, r *http.Request) {
 		statusHandler(w, r, n)
 	})
@@ -123,19 +398,112 @@ func (n *Node) Run(ctx context.Context) error {
 		syncHandler(w, r, n)
 	})
 
+	handler.HandleFunc(endpointHeaders, func(w http.ResponseWriter, r *http.Request) {
+		headersHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointHandshake, func(w http.ResponseWriter, r *http.Request) {
+		handshakeHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointAddPeer, func(w http.ResponseWriter, r *http.Request) {
 		addPeerHandler(w, r, n)
 	})
 
-	server := &http.Server{Addr: fmt.Sprintf(":%d", n.info.Port), Handler: handler}
+	handler.Handle(endpointAdminPeers, n.requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		adminPeersHandler(w, r, n)
+	}))
+
+	handler.Handle(endpointAdminMining, n.requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		adminMiningHandler(w, r, n)
+	}))
+
+	handler.Handle(endpointAdminMiner, n.requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		adminMinerHandler(w, r, n)
+	}))
+
+	handler.Handle(endpointAdminMempoolFlush, n.requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		adminMempoolFlushHandler(w, r, n)
+	}))
+
+	handler.Handle(endpointAdminWebhookDeliveries, n.requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		adminWebhookDeliveriesHandler(w, r, n)
+	}))
+
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", n.info.Port),
+		ReadTimeout:  n.readTimeout,
+		WriteTimeout: n.writeTimeout,
+	}
+
+	var apiHandler http.Handler = handler
+
+	// Peers may serve https even if this node doesn't
+	serverTLSConfig, clientTLSConfig, err := loadTLSConfigs(n.dataDir, n.tls)
+	if err != nil {
+		return err
+	}
+	n.peerClient = newPeerHTTPClient(clientTLSConfig)
+
+	if n.tls.Enabled {
+		server.TLSConfig = serverTLSConfig
+
+		if n.tls.Mutual {
+			apiHandler = requirePeerCert(handler)
+		}
+	}
+
+	// The CORS headers are set first so browsers can read the 429 responses
+	server.Handler = n.metrics.instrument(handler, withCORS(n.cors, n.rateLimiter.limit(
+		handler, limitReqBody(n.maxBodyBytes, apiHandler))))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var workers sync.WaitGroup
+	workers.Add(2)
+
+	go func() {
+		defer workers.Done()
+		n.sync(ctx)
+	}()
+
+	go func() {
+		defer workers.Done()
+		n.mine(ctx)
+	}()
 
+	serverStopped := make(chan struct{})
 	go func() {
+		defer close(serverStopped)
 		<-ctx.Done()
-		_ = server.Close()
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(
+			context.Background(), n.shutdownTimeout)
+		defer cancelShutdown()
+
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			n.httpLogger.Warn("HTTP server didn't stop gracefully", "err", err)
+			_ = server.Close()
+		}
 	}()
 
-	err = server.ListenAndServe()
-	// This shouldn't be an error!
+	n.httpLogger.Info("Listening", "ip", n.info.IP, "port", n.info.Port, "tls", n.tls.Enabled)
+
+	if n.tls.Enabled {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	n.logger.Info("Stopping node")
+
+	// The server might have failed on its own, stop the rest of the node too
+	cancel()
+	<-serverStopped
+	n.shutdown(&workers)
+
 	if err != http.ErrServerClosed {
 		return err
 	}
@@ -143,6 +511,22 @@ func (n *Node) Run(ctx context.Context) error {
 	return nil
 }
 
+// shutdown waits for the sync and miner `workers` to stop, disconnects the
+// subscribers and flushes the mempool.
+func (n *Node) shutdown(workers *sync.WaitGroup) {
+	workers.Wait()
+
+	n.wsHub.closeAll()
+	n.webhooks.stop()
+
+	err := n.flushMempool()
+	if err != nil {
+		n.logger.Error("Unable to flush the mempool", "err", err)
+	}
+
+	n.logger.Info("Node stopped", "pendingTXs", n.pendingTXsCount())
+}
+
 func (n *Node) LatestBlockHash() database.Hash {
 	return n.state.LatestBlockHash()
 }
@@ -151,19 +535,24 @@ func (n *Node) mine(ctx context.Context) error {
 	var miningCtx context.Context
 	var stopCurrentMining context.CancelFunc
 
-	ticker := time.NewTicker(time.Second * miningIntervalSeconds)
+	ticker := time.NewTicker(n.miningInterval)
+
+	var mining sync.WaitGroup
 
 	for {
 		select {
 		case <-ticker.C:
+			mining.Add(1)
 			go func() {
-				if len(n.pendingTXs) > 0 && !n.isMining {
+				defer mining.Done()
+
+				if n.pendingTXsCount() > 0 && !n.isMining && n.isMiningEnabled() {
 					n.isMining = true
 
 					miningCtx, stopCurrentMining = context.WithCancel(ctx)
 					err := n.minePendingTXs(miningCtx)
 					if err != nil {
-						fmt.Printf("ERROR: %s\n", err)
+						n.minerLogger.Error("Mining failed", "err", err)
 					}
 
 					n.isMining = false
@@ -173,15 +562,25 @@ func (n *Node) mine(ctx context.Context) error {
 		case block, _ := <-n.newSyncedBlocks:
 			if n.isMining {
 				blockHash, _ := block.Hash()
-				fmt.Printf(
-					"\nPeer mined next Block '%s' faster :(\n", blockHash.Hex())
+				n.minerLogger.Info("Peer mined the next block faster", "hash", blockHash.Hex())
 
 				n.removeMinedPendingTXs(block)
 				stopCurrentMining()
 			}
 
+		case <-n.miningAbandoned:
+			if n.isMining {
+				n.minerLogger.Info("Abandoning the block being mined")
+				stopCurrentMining()
+			}
+
 		case <-ctx.Done():
 			ticker.Stop()
+
+			// The current mining is cancelled with the ctx, the mined block
+			// must still be committed before the state is closed
+			mining.Wait()
+
 			return nil
 		}
 	}
@@ -191,34 +590,45 @@ func (n *Node) minePendingTXs(ctx context.Context) error {
 	blockToMine := NewPendingBlock(
 		n.state.LatestBlockHash(),
 		n.state.NextBlockNumber(),
-		n.info.Account,
+		n.minerAccount(),
 		n.getPendingTXsAsArray(),
 	)
 
-	minedBlock, err := Mine(ctx, blockToMine)
+	block := blockToMine.block(0)
+
+	err := n.consensus.Prepare(&block.Header)
+	if errors.Is(err, consensus.ErrNotInTurn) {
+		n.minerLogger.Debug("Waiting for the next block to be sealed", "reason", err)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	n.removeMinedPendingTXs(minedBlock)
+	minedBlock, err := n.consensus.Seal(ctx, block)
+	if err != nil {
+		return err
+	}
 
-	_, err = n.state.AddBlock(minedBlock)
+	err = n.addBlock(minedBlock)
 	if err != nil {
 		return err
 	}
 
+	// Only once added, a block failing to be added leaves its TXs pending
+	n.removeMinedPendingTXs(minedBlock)
+
 	return nil
 }
 
 func (n *Node) removeMinedPendingTXs(block database.Block) {
-	if len(block.TXs) > 0 && len(n.pendingTXs) > 0 {
-		fmt.Println("Updating in-memory Pending TXs Pool:")
-	}
+	n.mempoolMu.Lock()
+	defer n.mempoolMu.Unlock()
 
 	for _, tx := range block.TXs {
 		txHash, _ := tx.Hash()
 		if _, exists := n.pendingTXs[txHash.Hex()]; exists {
-			fmt.Printf("\t-archiving mined TX: %s\n", txHash.Hex())
+			n.minerLogger.Debug("Archiving mined TX", "hash", txHash.Hex())
 
 			n.archivedTXs[txHash.Hex()] = tx
 			delete(n.pendingTXs, txHash.Hex())
@@ -227,11 +637,35 @@ func (n *Node) removeMinedPendingTXs(block database.Block) {
 }
 
 func (n *Node) AddPeer(peer PeerNode) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	n.addKnownPeer(peer)
+}
+
+// addKnownPeer adds or updates the `peer`. The caller holds peersMu.
+func (n *Node) addKnownPeer(peer PeerNode) {
+	_, isKnownPeer := n.knownPeers[peer.TcpAddress()]
+
 	n.knownPeers[peer.TcpAddress()] = peer
+
+	if !isKnownPeer {
+		n.saveKnownPeers()
+	}
 }
 
 func (n *Node) RemovePeer(peer PeerNode) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	n.removeKnownPeer(peer)
+}
+
+// removeKnownPeer forgets the `peer`. The caller holds peersMu.
+func (n *Node) removeKnownPeer(peer PeerNode) {
 	delete(n.knownPeers, peer.TcpAddress())
+
+	n.saveKnownPeers()
 }
 
 func (n *Node) IsKnownPeer(peer PeerNode) bool {
@@ -239,36 +673,82 @@ func (n *Node) IsKnownPeer(peer PeerNode) bool {
 		return true
 	}
 
-	_, isKnownPeer := n.knownPeers[peer.TcpAddress()]
+	_, isKnownPeer := n.knownPeer(peer.TcpAddress())
 
 	return isKnownPeer
 }
 
-func (n *Node) AddPendingTX(tx database.SignedTx, fromPeer PeerNode) error {
-	txHash, err := tx.Hash()
-	if err != nil {
-		return err
+// knownPeer looks up the known Peer listening on `tcpAddress`.
+func (n *Node) knownPeer(tcpAddress string) (PeerNode, bool) {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	peer, isKnownPeer := n.knownPeers[tcpAddress]
+
+	return peer, isKnownPeer
+}
+
+// knownPeersCopy returns the known Peers by their TCP address, for the
+// caller to range over without holding peersMu.
+func (n *Node) knownPeersCopy() map[string]PeerNode {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	peers := make(map[string]PeerNode, len(n.knownPeers))
+	for tcpAddress, peer := range n.knownPeers {
+		peers[tcpAddress] = peer
 	}
 
-	txJson, err := json.Marshal(tx)
+	return peers
+}
+
+func (n *Node) AddPendingTX(tx database.SignedTx, fromPeer PeerNode) error {
+	txHash, err := tx.Hash()
 	if err != nil {
 		return err
 	}
 
+	n.mempoolMu.Lock()
 	_, isAlreadyPending := n.pendingTXs[txHash.Hex()]
 	_, isArchived := n.archivedTXs[txHash.Hex()]
 
-	if !isAlreadyPending && !isArchived {
-		fmt.Printf(
-			"Added Pending TX %s from Peer %s\n", txJson, fromPeer.TcpAddress())
+	isNew := !isAlreadyPending && !isArchived
+	if isNew {
 		n.pendingTXs[txHash.Hex()] = tx
+	}
+	n.mempoolMu.Unlock()
+
+	if isNew {
+		n.logger.Info(
+			"Added pending TX", "hash", txHash.Hex(), "peer", fromPeer.TcpAddress())
+		n.logger.Trace("Added pending TX", "tx", tx)
 		n.newPendingTXs <- tx
+		n.publishPendingTX(txHash, tx)
 	}
 
 	return nil
 }
 
+func (n *Node) isPendingTX(txHash database.Hash) bool {
+	n.mempoolMu.RLock()
+	defer n.mempoolMu.RUnlock()
+
+	_, isPending := n.pendingTXs[txHash.Hex()]
+
+	return isPending
+}
+
+func (n *Node) pendingTXsCount() int {
+	n.mempoolMu.RLock()
+	defer n.mempoolMu.RUnlock()
+
+	return len(n.pendingTXs)
+}
+
 func (n *Node) getPendingTXsAsArray() []database.SignedTx {
+	n.mempoolMu.RLock()
+	defer n.mempoolMu.RUnlock()
+
 	txs := make([]database.SignedTx, len(n.pendingTXs))
 
 	i := 0
@@ -11,8 +11,10 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/simone-trubian/blockchain-tutorial/database"
 	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
 	"github.com/simone-trubian/blockchain-tutorial/wallet"
 )
 
@@ -44,16 +46,12 @@ func TestNode_Run(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	n := New(
-		datadir,
-		"127.0.0.1",
-		8085,
-		database.NewAccount(DefaultMiner), PeerNode{})
+	n := New(newTestConfig(datadir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), []PeerNode{}), logger.Discard())
 
 	ctx, _ := context.WithTimeout(context.Background(), time.Second*5)
 	err = n.Run(ctx)
-	if err.Error() != "http: Server closed" {
-		t.Fatal("node server was suppose to close after 5s")
+	if err != nil {
+		t.Fatalf("node was suppose to stop cleanly after 5s, got %s", err)
 	}
 }
 
@@ -94,7 +92,7 @@ func TestNode_Mining(t *testing.T) {
 
 	// Construct a new Node instance and configure
 	// Simone as a miner
-	n := New(dataDir, nInfo.IP, nInfo.Port, simone, nInfo)
+	n := New(newTestConfig(dataDir, nInfo.IP, nInfo.Port, simone, []PeerNode{nInfo}), logger.Discard())
 
 	// Allow the mining to run for 30 mins, in the worst case
 	ctx, closeNode := context.WithTimeout(
@@ -105,7 +103,7 @@ func TestNode_Mining(t *testing.T) {
 	// Schedule a new TX in 3 seconds from now, in a separate thread
 	// because the n.Run() few lines below is a blocking call
 	go func() {
-		time.Sleep(time.Second * miningIntervalSeconds / 3)
+		time.Sleep(DefaultMiningInterval / 3)
 
 		tx := database.NewTx(simone, tanya, 1, "")
 		signedTx, err := wallet.SignTxWithKeystoreAccount(
@@ -121,7 +119,7 @@ func TestNode_Mining(t *testing.T) {
 	// Schedule a new TX in 12 seconds from now simulating
 	// that it came in - while the first TX is being mined
 	go func() {
-		time.Sleep(time.Second*miningIntervalSeconds + 2)
+		time.Sleep(DefaultMiningInterval + 2)
 
 		tx := database.NewTx(simone, tanya, 2, "")
 		signedTx, err := wallet.SignTxWithKeystoreAccount(
@@ -201,7 +199,7 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 		true,
 	)
 
-	n := New(dataDir, nInfo.IP, nInfo.Port, tanya, nInfo)
+	n := New(newTestConfig(dataDir, nInfo.IP, nInfo.Port, tanya, []PeerNode{nInfo}), logger.Discard())
 
 	// Allow the test to run for 30 mins, in the worst case
 	ctx, closeNode := context.WithTimeout(context.Background(), time.Minute*30)
@@ -233,14 +231,14 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 	// to simulate the block came on the fly from another peer
 	validPreMinedPb := NewPendingBlock(
 		database.Hash{}, 0, simone, []database.SignedTx{signedTx1})
-	validSyncedBlock, err := Mine(ctx, validPreMinedPb)
+	validSyncedBlock, err := Mine(ctx, validPreMinedPb, 0, metrics.NewCounterForced(), logger.Discard())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// Add 2 new TXs into the Tanya's node, triggers mining
 	go func() {
-		time.Sleep(time.Second * (miningIntervalSeconds - 2))
+		time.Sleep(DefaultMiningInterval - 2*time.Second)
 
 		err := n.AddPendingTX(signedTx1, nInfo)
 		if err != nil {
@@ -258,7 +256,7 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 	// mine which means the mining will start again for the one pending TX
 	// that is left and wasn't in the synced block
 	go func() {
-		time.Sleep(time.Second * (miningIntervalSeconds + 2))
+		time.Sleep(DefaultMiningInterval + 2*time.Second)
 		if !n.isMining {
 			t.Fatal("should be mining")
 		}
@@ -282,7 +280,7 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 			t.Fatal("synced block should have canceled mining of already mined TX")
 		}
 
-		time.Sleep(time.Second * (miningIntervalSeconds + 2))
+		time.Sleep(DefaultMiningInterval + 2*time.Second)
 		if !n.isMining {
 			t.Fatal("should be mining again the 1 TX not included in synced block")
 		}
@@ -349,6 +347,23 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 	}
 }
 
+// newTestConfig configures a node listening on `ip`:`port` with the
+// default intervals.
+func newTestConfig(
+	dataDir string,
+	ip string,
+	port uint64,
+	miner common.Address,
+	bootstraps []PeerNode) Config {
+	cfg := DefaultConfig(dataDir)
+	cfg.IP = ip
+	cfg.Port = port
+	cfg.Miner = miner
+	cfg.Bootstraps = bootstraps
+
+	return cfg
+}
+
 // Creates dir like: "/tmp/sb_test945924586"
 func getTestDataDirPath() (string, error) {
 	return ioutil.TempDir(os.TempDir(), "sb_test")
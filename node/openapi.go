@@ -0,0 +1,488 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const endpointOpenAPI = "/openapi.json"
+
+const openAPIVersion = "3.0.3"
+const openAPISchemasRef = "#/components/schemas/"
+
+// openAPIAdminSecurity names the bearer token scheme of the /admin/* endpoints.
+const openAPIAdminSecurity = "adminToken"
+
+// OpenAPISchema is the subset of the OpenAPI 3 schema object describing
+// the node JSON types.
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties interface{}               `json:"additionalProperties,omitempty"`
+}
+
+type apiParam struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      *OpenAPISchema
+}
+
+// apiOperation documents an endpoint. Req and Res are zero values of the
+// request and response body types.
+type apiOperation struct {
+	Method  string
+	Path    string
+	Summary string
+	Params  []apiParam
+	Req     interface{}
+	Res     interface{}
+}
+
+var hashSchema = &OpenAPISchema{Type: "string", Pattern: "^[0-9a-fA-F]{64}$"}
+var addressSchema = &OpenAPISchema{Type: "string", Pattern: "^0x[0-9a-fA-F]{40}$"}
+
+func queryParam(name string, required bool, description string, schema *OpenAPISchema) apiParam {
+	return apiParam{name, "query", description, required, schema}
+}
+
+func pathParam(name string, description string, schema *OpenAPISchema) apiParam {
+	return apiParam{name, "path", description, true, schema}
+}
+
+func newTypeSchema(openAPIType string) *OpenAPISchema {
+	return &OpenAPISchema{Type: openAPIType}
+}
+
+var apiOperations = []apiOperation{
+	{http.MethodGet, "/balances/list", "List the balances at the latest block", nil, nil, BalancesRes{}},
+	{http.MethodPost, "/tx/add", "Sign a TX with a keystore account of the node and add it to the Mempool", nil, TxAddReq{}, TxAddRes{}},
+	{http.MethodPost, "/tx/submit", "Add a TX signed client-side to the Mempool", nil, database.SignedTx{}, TxSubmitRes{}},
+	{http.MethodGet, endpointTx + "{hash}", "Report a TX status", []apiParam{
+		pathParam("hash", "TX hash", hashSchema),
+	}, nil, TxStatusRes{}},
+	{http.MethodGet, endpointBlocks, "List the blocks numbered from `from` to `to`", []apiParam{
+		queryParam(endpointBlocksQueryKeyFrom, true, "first block number", newTypeSchema("integer")),
+		queryParam(endpointBlocksQueryKeyTo, false, "last block number, included", newTypeSchema("integer")),
+	}, nil, BlocksRes{}},
+	{http.MethodGet, endpointBlock + endpointBlockLatest, "Get the latest block", nil, nil, BlockRes{}},
+	{http.MethodGet, endpointBlock + "{number}", "Get a block by number", []apiParam{
+		pathParam("number", "block number", newTypeSchema("integer")),
+	}, nil, BlockRes{}},
+	{http.MethodGet, endpointBlock + endpointBlockByHash + "{hash}", "Get a block by hash", []apiParam{
+		pathParam("hash", "block hash", hashSchema),
+	}, nil, BlockRes{}},
+	{http.MethodGet, endpointMiningWork, "Get a block template of the pending TXs for an external miner", []apiParam{
+		queryParam(endpointMiningWorkQueryKeyMiner, false, "account credited with the block reward, the node miner if omitted", addressSchema),
+	}, nil, MiningWorkRes{}},
+	{http.MethodPost, endpointMiningSubmit, "Submit the nonce solving a block template", nil, MiningSubmitReq{}, MiningSubmitRes{}},
+	{http.MethodGet, endpointStatus, "Report the node status", nil, nil, StatusRes{}},
+	{http.MethodGet, endpointSync, "List a page of blocks following a block", []apiParam{
+		queryParam(endpointSyncQueryKeyFromBlock, false, "hash of the block preceding the page", hashSchema),
+		queryParam(endpointSyncQueryKeyLimit, false, "page size", newTypeSchema("integer")),
+	}, nil, SyncRes{}},
+	{http.MethodGet, endpointHeaders, "List a page of block headers following a block", []apiParam{
+		queryParam(endpointSyncQueryKeyFromBlock, false, "hash of the block preceding the page", hashSchema),
+		queryParam(endpointSyncQueryKeyLimit, false, "page size", newTypeSchema("integer")),
+	}, nil, HeadersRes{}},
+	{http.MethodGet, endpointHandshake, "Prove the node identity by signing the challenge", []apiParam{
+		queryParam(endpointHandshakeQueryKeyChallenge, true, "hex encoded challenge", newTypeSchema("string")),
+		queryParam(endpointHandshakeQueryKeyIP, true, "joining node IP", newTypeSchema("string")),
+		queryParam(endpointHandshakeQueryKeyPort, true, "joining node port", newTypeSchema("integer")),
+	}, nil, HandshakeRes{}},
+	{http.MethodGet, endpointAddPeer, "Join the KnownPeers of the node", []apiParam{
+		queryParam(endpointAddPeerQueryKeyIP, true, "joining node IP", newTypeSchema("string")),
+		queryParam(endpointAddPeerQueryKeyPort, true, "joining node port", newTypeSchema("integer")),
+		queryParam(endpointAddPeerQueryKeyAccount, true, "joining node account", addressSchema),
+		queryParam(endpointAddPeerQueryKeyChallenge, true, "challenge issued by the handshake", newTypeSchema("string")),
+		queryParam(endpointAddPeerQueryKeySig, true, "hex encoded handshake signature", newTypeSchema("string")),
+		queryParam(endpointAddPeerQueryKeyTLS, false, "whether the joining node serves HTTPS", newTypeSchema("boolean")),
+	}, nil, AddPeerRes{}},
+	{http.MethodPost, endpointRPC, "Call a JSON-RPC 2.0 method, batches are sent as arrays", nil, RPCReq{}, RPCRes{}},
+	{http.MethodGet, endpointWS, "Subscribe to chain events over a WebSocket", nil, nil, nil},
+	{http.MethodGet, endpointOpenAPI, "Describe the node API", nil, nil, nil},
+	{http.MethodGet, endpointHealthz, "Report the node is alive", nil, nil, HealthRes{}},
+	{http.MethodGet, endpointReadyz, "Report whether the node is synced and ready, answering 503 otherwise", nil, nil, ReadinessRes{}},
+	{http.MethodGet, endpointMetrics, "Expose the node metrics in the Prometheus text format", nil, nil, nil},
+	{http.MethodGet, endpointAdminPeers, "List the known and banned peers", nil, nil, AdminPeersRes{}},
+	{http.MethodPost, endpointAdminPeers, "Add a peer, lifting its ban if any", nil, AdminPeerAddReq{}, AdminPeersRes{}},
+	{http.MethodDelete, endpointAdminPeers, "Remove a peer from the KnownPeers", []apiParam{
+		queryParam(endpointAdminPeersQueryKeyIP, true, "peer IP", newTypeSchema("string")),
+		queryParam(endpointAdminPeersQueryKeyPort, true, "peer port", newTypeSchema("integer")),
+		queryParam(endpointAdminPeersQueryKeyBan, false, "whether to ban the peer too", newTypeSchema("boolean")),
+	}, nil, AdminPeersRes{}},
+	{http.MethodGet, endpointAdminMining, "Report the miner settings", nil, nil, AdminMiningRes{}},
+	{http.MethodPost, endpointAdminMining, "Pause or resume mining", nil, AdminMiningReq{}, AdminMiningRes{}},
+	{http.MethodPost, endpointAdminMiner, "Change the account receiving the block rewards", nil, AdminMinerReq{}, AdminMiningRes{}},
+	{http.MethodPost, endpointAdminMempoolFlush, "Drop every pending TX", nil, nil, AdminMempoolFlushRes{}},
+	{http.MethodGet, endpointAdminWebhookDeliveries, "List the most recent webhook deliveries", []apiParam{
+		queryParam(endpointAdminWebhookDeliveriesQueryKeyWebhook, false, "webhook id", newTypeSchema("string")),
+	}, nil, WebhookDeliveriesRes{}},
+}
+
+// openAPISchemas derives the schemas of the Go types from their JSON
+// encoding. Struct types are registered as components.
+//
+// A struct field is required unless tagged `omitempty`.
+type openAPISchemas struct {
+	mu         sync.Mutex
+	components map[string]*OpenAPISchema
+}
+
+var apiSchemas = &openAPISchemas{components: make(map[string]*OpenAPISchema)}
+
+var openAPISpec = newOpenAPISpec(apiOperations, apiSchemas)
+
+func (s *openAPISchemas) schemaOf(t reflect.Type) *OpenAPISchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.schemaOfLocked(t)
+}
+
+func (s *openAPISchemas) schemaOfLocked(t reflect.Type) *OpenAPISchema {
+	switch t {
+	case reflect.TypeOf(database.Hash{}):
+		return hashSchema
+	case reflect.TypeOf(common.Address{}):
+		return addressSchema
+	case reflect.TypeOf(json.RawMessage{}):
+		return &OpenAPISchema{}
+	case reflect.TypeOf(time.Time{}):
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schemaOfLocked(t.Elem())
+	case reflect.Bool:
+		return newTypeSchema("boolean")
+	case reflect.String:
+		return newTypeSchema("string")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return newTypeSchema("integer")
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := float64(0)
+		return &OpenAPISchema{Type: "integer", Minimum: &minimum}
+	case reflect.Float32, reflect.Float64:
+		return newTypeSchema("number")
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+
+		return &OpenAPISchema{Type: "array", Items: s.schemaOfLocked(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: s.schemaOfLocked(t.Elem())}
+	case reflect.Struct:
+		if _, isRegistered := s.components[t.Name()]; !isRegistered {
+			// Registered before its fields, in case of recursive types
+			s.components[t.Name()] = &OpenAPISchema{}
+			*s.components[t.Name()] = *s.structSchema(t)
+		}
+
+		return &OpenAPISchema{Ref: openAPISchemasRef + t.Name()}
+	}
+
+	// Interfaces accept any JSON value
+	return &OpenAPISchema{}
+}
+
+func (s *openAPISchemas) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{
+		Type:                 "object",
+		Properties:           make(map[string]*OpenAPISchema),
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options := parseJsonTag(field)
+
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		// Embedded structs are flattened by the JSON encoding
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := s.structSchema(field.Type)
+			for property, propertySchema := range embedded.Properties {
+				schema.Properties[property] = propertySchema
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = s.schemaOfLocked(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+func parseJsonTag(field reflect.StructField) (string, string) {
+	tag := field.Tag.Get("json")
+
+	name := tag
+	options := ""
+	if i := strings.Index(tag, ","); i >= 0 {
+		name = tag[:i]
+		options = tag[i+1:]
+	}
+
+	return name, options
+}
+
+func (s *openAPISchemas) resolve(schema *OpenAPISchema) *OpenAPISchema {
+	if schema.Ref == "" {
+		return schema
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.components[strings.TrimPrefix(schema.Ref, openAPISchemasRef)]
+}
+
+// validate checks the decoded JSON `value` against the `schema`, naming
+// the offending field by its `path`.
+func (s *openAPISchemas) validate(schema *OpenAPISchema, value interface{}, path string) error {
+	schema = s.resolve(schema)
+
+	if value == nil {
+		if schema.Type == "" {
+			return nil
+		}
+
+		return fmt.Errorf("%s must not be null", describePath(path))
+	}
+
+	switch schema.Type {
+	case "object":
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return fmt.Errorf("%s must be an object", describePath(path))
+		}
+
+		for _, required := range schema.Required {
+			if _, isSet := object[required]; !isSet {
+				return fmt.Errorf("'%s' is required", joinPath(path, required))
+			}
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			propertySchema, isKnown := schema.Properties[key]
+			if !isKnown {
+				additional, isSchema := schema.AdditionalProperties.(*OpenAPISchema)
+				if !isSchema {
+					return fmt.Errorf("'%s' is an unknown field", joinPath(path, key))
+				}
+				propertySchema = additional
+			}
+
+			err := s.validate(propertySchema, object[key], joinPath(path, key))
+			if err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		array, isArray := value.([]interface{})
+		if !isArray {
+			return fmt.Errorf("%s must be an array", describePath(path))
+		}
+
+		for i, item := range array {
+			err := s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		str, isString := value.(string)
+		if !isString {
+			return fmt.Errorf("%s must be a string", describePath(path))
+		}
+
+		if schema.Pattern != "" && !regexp.MustCompile(schema.Pattern).MatchString(str) {
+			return fmt.Errorf("%s must match '%s'", describePath(path), schema.Pattern)
+		}
+
+	case "integer", "number":
+		article := "a"
+		if schema.Type == "integer" {
+			article = "an"
+		}
+
+		number, isNumber := value.(json.Number)
+		if !isNumber {
+			return fmt.Errorf("%s must be %s %s", describePath(path), article, schema.Type)
+		}
+
+		parsed, err := strconv.ParseFloat(number.String(), 64)
+		if err != nil || (schema.Type == "integer" && strings.ContainsAny(number.String(), ".eE")) {
+			return fmt.Errorf("%s must be %s %s", describePath(path), article, schema.Type)
+		}
+
+		if schema.Minimum != nil && parsed < *schema.Minimum {
+			return fmt.Errorf("%s must be at least %v", describePath(path), *schema.Minimum)
+		}
+
+	case "boolean":
+		if _, isBool := value.(bool); !isBool {
+			return fmt.Errorf("%s must be a boolean", describePath(path))
+		}
+	}
+
+	return nil
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "request body"
+	}
+
+	return fmt.Sprintf("'%s'", path)
+}
+
+// validateReq checks the JSON request body against the schema of the
+// `reqBody` type.
+func validateReq(reqBodyJson []byte, reqBody interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(string(reqBodyJson)))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return fmt.Errorf("request body is not valid JSON. %s", err.Error())
+	}
+
+	schema := apiSchemas.schemaOf(reflect.TypeOf(reqBody))
+
+	return apiSchemas.validate(schema, value, "")
+}
+
+func newOpenAPISpec(operations []apiOperation, schemas *openAPISchemas) map[string]interface{} {
+	errResSchema := schemas.schemaOf(reflect.TypeOf(ErrRes{}))
+	paths := make(map[string]map[string]interface{})
+
+	for _, op := range operations {
+		operation := map[string]interface{}{"summary": op.Summary}
+
+		if len(op.Params) > 0 {
+			params := make([]map[string]interface{}, 0, len(op.Params))
+			for _, param := range op.Params {
+				params = append(params, map[string]interface{}{
+					"name":        param.Name,
+					"in":          param.In,
+					"description": param.Description,
+					"required":    param.Required,
+					"schema":      param.Schema,
+				})
+			}
+			operation["parameters"] = params
+		}
+
+		if op.Req != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemas.schemaOf(reflect.TypeOf(op.Req))),
+			}
+		}
+
+		okRes := map[string]interface{}{"description": "OK"}
+		if op.Res != nil {
+			okRes["content"] = jsonContent(schemas.schemaOf(reflect.TypeOf(op.Res)))
+		}
+
+		operation["responses"] = map[string]interface{}{
+			"200": okRes,
+			"4XX": map[string]interface{}{
+				"description": "Invalid request",
+				"content":     jsonContent(errResSchema),
+			},
+			"5XX": map[string]interface{}{
+				"description": "Node failure",
+				"content":     jsonContent(errResSchema),
+			},
+		}
+
+		if strings.HasPrefix(op.Path, endpointAdmin) {
+			operation["security"] = []map[string][]string{{openAPIAdminSecurity: {}}}
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = make(map[string]interface{})
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "sb node API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				openAPIAdminSecurity: map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func jsonContent(schema *OpenAPISchema) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !isMethodAllowed(w, r, http.MethodGet) {
+		return
+	}
+
+	writeRes(w, openAPISpec)
+}
@@ -0,0 +1,109 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	openAPIHandler(rec, httptest.NewRequest(http.MethodGet, endpointOpenAPI, nil))
+
+	spec := struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]OpenAPISchema `json:"schemas"`
+		} `json:"components"`
+	}{}
+	err := json.Unmarshal(rec.Body.Bytes(), &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.OpenAPI != openAPIVersion {
+		t.Fatalf("expected OpenAPI %s, got %s", openAPIVersion, spec.OpenAPI)
+	}
+
+	for _, op := range apiOperations {
+		if _, isDocumented := spec.Paths[op.Path][strings.ToLower(op.Method)]; !isDocumented {
+			t.Fatalf("%s %s should be documented", op.Method, op.Path)
+		}
+	}
+
+	signedTx := spec.Components.Schemas["SignedTx"]
+	if signedTx.Properties["from"] == nil || signedTx.Properties["signature"] == nil {
+		t.Fatal("embedded Tx fields should be flattened into the SignedTx schema")
+	}
+
+	txAddReq := spec.Components.Schemas["TxAddReq"]
+	if strings.Join(txAddReq.Required, ",") != "from,from_pwd,to,value" {
+		t.Fatalf("unexpected TxAddReq required fields %v", txAddReq.Required)
+	}
+}
+
+func TestValidateReq(t *testing.T) {
+	cases := map[string]string{
+		`{"from_pwd": "pwd", "to": "0x0", "value": 1}`:                              "'from' is required",
+		`{"from": "0x0", "from_pwd": "pwd", "to": "0x0", "value": -1}`:              "'value' must be at least 0",
+		`{"from": "0x0", "from_pwd": "pwd", "to": "0x0", "value": "1"}`:             "'value' must be an integer",
+		`{"from": "0x0", "from_pwd": "pwd", "to": "0x0", "value": 1, "fee": 1}`:     "'fee' is an unknown field",
+		`{"from": "0x0", "from_pwd": "pwd", "to": "0x0", "value": 1, "data": "sb"}`: "",
+		`[]`: "request body must be an object",
+	}
+
+	for body, expectedErr := range cases {
+		err := validateReq([]byte(body), &TxAddReq{})
+
+		if expectedErr == "" && err != nil {
+			t.Fatalf("%s should be valid, got %s", body, err)
+		}
+
+		if expectedErr != "" && (err == nil || err.Error() != expectedErr) {
+			t.Fatalf("%s should fail with %q, got %v", body, expectedErr, err)
+		}
+	}
+
+	err := validateReq([]byte(
+		`{"from": "0x22ba", "to": "0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8", "value": 1, "data": "", "time": 1, "signature": ""}`),
+		&database.SignedTx{})
+	if err == nil || !strings.Contains(err.Error(), "'from' must match") {
+		t.Fatalf("malformed address should be rejected, got %v", err)
+	}
+}
+
+func TestHandlersAnswerClientErrorsWith4xx(t *testing.T) {
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+
+	rec := httptest.NewRecorder()
+	txAddHandler(rec, httptest.NewRequest(http.MethodPost, "/tx/add", strings.NewReader(`{"from":`)), n)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed JSON should be a bad request, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	txAddHandler(rec, httptest.NewRequest(http.MethodPost, "/tx/add", bytes.NewReader([]byte(
+		`{"from": "0x22ba1f80452e6220c7cc6ea2d1e3eeddac5f694a", "from_pwd": "wrong", "to": "0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8", "value": 1}`))), n)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown keystore account should be a bad request, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	txSubmitHandler(rec, httptest.NewRequest(http.MethodGet, "/tx/submit", nil), n)
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("GET should not be allowed, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	syncHandler(rec, httptest.NewRequest(http.MethodGet, endpointSync+"?limit=many", nil), n)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid limit should be a bad request, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,328 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/client"
+)
+
+const DefaultPeerBanDuration = 24 * time.Hour
+
+const peerRequestTimeout = 30 * time.Second
+
+// A Peer starts with a zero score, loses points whenever it misbehaves
+// and slowly earns them back, up to zero, by answering properly.
+//
+// Once its score drops to peerScoreBanThreshold the Peer gets banned.
+const peerScoreBanThreshold = -100
+const peerRewardGoodRes = 1
+
+const peerPenaltyInvalidBlock = 50
+const peerPenaltyInvalidTx = 20
+const peerPenaltyInvalidHandshake = 50
+const peerPenaltyMalformedRes = 20
+const peerPenaltyTimeout = 10
+
+const peersDirName = "peers"
+const bannedPeersFileName = "banned.json"
+const knownPeersFileName = "known.json"
+
+const bootnodeTLSPrefix = "https://"
+
+type BannedPeer struct {
+	IP      string         `json:"ip"`
+	Port    uint64         `json:"port"`
+	Account common.Address `json:"account"`
+	Reason  string         `json:"reason"`
+	Until   time.Time      `json:"until"`
+}
+
+func (bp BannedPeer) TcpAddress() string {
+	return fmt.Sprintf("%s:%d", bp.IP, bp.Port)
+}
+
+// peerMisbehaviourErr is an error caused by a Peer breaking the protocol,
+// costing the Peer `penalty` points of its score.
+type peerMisbehaviourErr struct {
+	penalty int
+	err     error
+}
+
+func newPeerMisbehaviourErr(penalty int, err error) peerMisbehaviourErr {
+	return peerMisbehaviourErr{penalty, err}
+}
+
+func (e peerMisbehaviourErr) Error() string {
+	return e.err.Error()
+}
+
+// penaltyFor returns how many score points the `err` costs a Peer.
+//
+// Errors not caused by a misbehaviour are failed or timed out requests. A
+// Peer refusing requests over its rate limit isn't penalized, the node is
+// the one calling too often.
+func penaltyFor(err error) int {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		return 0
+	}
+
+	var misbehaviourErr peerMisbehaviourErr
+	if errors.As(err, &misbehaviourErr) {
+		return misbehaviourErr.penalty
+	}
+
+	// A response body that can't be decoded is a Peer misbehaviour
+	var malformedResErr *client.MalformedResError
+	if errors.As(err, &malformedResErr) {
+		return peerPenaltyMalformedRes
+	}
+
+	return peerPenaltyTimeout
+}
+
+func (n *Node) penalizePeer(peer PeerNode, err error) {
+	// Requests cancelled by the node shutting down aren't the Peer fault
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	// Peers are only penalized by failed syncs
+	n.metrics.countSyncError(peer.TcpAddress())
+
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	knownPeer, isKnownPeer := n.knownPeers[peer.TcpAddress()]
+	if !isKnownPeer {
+		return
+	}
+
+	penalty := penaltyFor(err)
+	if penalty == 0 {
+		n.peersLogger.Debug("Peer request failed", "peer", knownPeer.TcpAddress(), "err", err)
+		return
+	}
+
+	knownPeer.score -= penalty
+
+	n.peersLogger.Warn(
+		"Peer misbehaved",
+		"peer", knownPeer.TcpAddress(),
+		"score", knownPeer.score,
+		"err", err)
+
+	if knownPeer.score <= peerScoreBanThreshold {
+		n.addBannedPeer(knownPeer, err.Error())
+		return
+	}
+
+	n.addKnownPeer(knownPeer)
+}
+
+func (n *Node) rewardPeer(peer PeerNode) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	knownPeer, isKnownPeer := n.knownPeers[peer.TcpAddress()]
+	if !isKnownPeer || knownPeer.score >= 0 {
+		return
+	}
+
+	knownPeer.score += peerRewardGoodRes
+
+	n.addKnownPeer(knownPeer)
+}
+
+func (n *Node) banPeer(peer PeerNode, reason string) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	n.addBannedPeer(peer, reason)
+}
+
+// addBannedPeer bans the `peer` and removes it from the KnownPeers. The
+// caller holds peersMu.
+func (n *Node) addBannedPeer(peer PeerNode, reason string) {
+	bannedPeer := BannedPeer{
+		IP:      peer.IP,
+		Port:    peer.Port,
+		Account: peer.Account,
+		Reason:  reason,
+		Until:   time.Now().Add(n.peerBanDuration),
+	}
+
+	n.bannedPeers[peer.TcpAddress()] = bannedPeer
+	n.removeKnownPeer(peer)
+
+	n.peersLogger.Warn(
+		"Peer banned",
+		"peer", peer.TcpAddress(),
+		"until", bannedPeer.Until.Format(time.RFC3339),
+		"reason", reason)
+
+	err := writeBannedPeersToDisk(n.dataDir, n.bannedPeers)
+	if err != nil {
+		n.peersLogger.Error("Unable to persist banned peers", "err", err)
+	}
+}
+
+func (n *Node) IsBannedPeer(peer PeerNode) bool {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	return n.isBanned(peer)
+}
+
+// isBanned forgets the ban of the `peer` once expired. The caller holds
+// peersMu.
+func (n *Node) isBanned(peer PeerNode) bool {
+	bannedPeer, isBanned := n.bannedPeers[peer.TcpAddress()]
+	if !isBanned {
+		return false
+	}
+
+	if time.Now().After(bannedPeer.Until) {
+		delete(n.bannedPeers, peer.TcpAddress())
+		return false
+	}
+
+	return true
+}
+
+// ParseBootnode parses a bootstrap Peer formatted as `ip:port`
+// or `account@ip:port`, prefixed with `https://` if the Peer serves TLS.
+func ParseBootnode(raw string) (PeerNode, error) {
+	account := ""
+	tcpAddress := strings.TrimPrefix(raw, bootnodeTLSPrefix)
+	isTLS := strings.HasPrefix(raw, bootnodeTLSPrefix)
+
+	if i := strings.Index(tcpAddress, "@"); i >= 0 {
+		account = tcpAddress[:i]
+		tcpAddress = tcpAddress[i+1:]
+	}
+
+	i := strings.LastIndex(tcpAddress, ":")
+	if i <= 0 {
+		return PeerNode{}, fmt.Errorf(
+			"bootnode '%s' must be formatted as [account@]ip:port", raw)
+	}
+
+	port, err := strconv.ParseUint(tcpAddress[i+1:], 10, 32)
+	if err != nil {
+		return PeerNode{}, fmt.Errorf(
+			"bootnode '%s' has an invalid port. %s", raw, err.Error())
+	}
+
+	if account != "" && !common.IsHexAddress(account) {
+		return PeerNode{}, fmt.Errorf(
+			"bootnode '%s' has an invalid account '%s'", raw, account)
+	}
+
+	peer := NewPeerNode(
+		tcpAddress[:i], port, true, common.HexToAddress(account), false)
+	peer.TLS = isTLS
+
+	return peer, nil
+}
+
+// saveKnownPeers persists the KnownPeers. The caller holds peersMu.
+func (n *Node) saveKnownPeers() {
+	err := writeKnownPeersToDisk(n.dataDir, n.knownPeers)
+	if err != nil {
+		n.peersLogger.Error("Unable to persist known peers", "err", err)
+	}
+}
+
+// LoadKnownPeers reads the Peers known by the node from the data dir.
+func LoadKnownPeers(dataDir string) (map[string]PeerNode, error) {
+	knownPeers := make(map[string]PeerNode)
+
+	content, err := ioutil.ReadFile(getKnownPeersFilePath(dataDir))
+	if os.IsNotExist(err) {
+		return knownPeers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &knownPeers)
+	if err != nil {
+		return nil, err
+	}
+
+	return knownPeers, nil
+}
+
+func writeKnownPeersToDisk(
+	dataDir string, knownPeers map[string]PeerNode) error {
+	err := os.MkdirAll(getPeersDirPath(dataDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	knownPeersJson, err := json.MarshalIndent(knownPeers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(getKnownPeersFilePath(dataDir), knownPeersJson, 0600)
+}
+
+// LoadBannedPeers reads the Peers banned by the node from the data dir.
+func LoadBannedPeers(dataDir string) (map[string]BannedPeer, error) {
+	bannedPeers := make(map[string]BannedPeer)
+
+	content, err := ioutil.ReadFile(getBannedPeersFilePath(dataDir))
+	if os.IsNotExist(err) {
+		return bannedPeers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &bannedPeers)
+	if err != nil {
+		return nil, err
+	}
+
+	return bannedPeers, nil
+}
+
+func writeBannedPeersToDisk(
+	dataDir string, bannedPeers map[string]BannedPeer) error {
+	err := os.MkdirAll(getPeersDirPath(dataDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	bannedPeersJson, err := json.MarshalIndent(bannedPeers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(getBannedPeersFilePath(dataDir), bannedPeersJson, 0600)
+}
+
+func getPeersDirPath(dataDir string) string {
+	return filepath.Join(dataDir, peersDirName)
+}
+
+func getKnownPeersFilePath(dataDir string) string {
+	return filepath.Join(getPeersDirPath(dataDir), knownPeersFileName)
+}
+
+func getBannedPeersFilePath(dataDir string) string {
+	return filepath.Join(getPeersDirPath(dataDir), bannedPeersFileName)
+}
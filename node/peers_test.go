@@ -0,0 +1,160 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/simone-trubian/blockchain-tutorial/client"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/fs"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+)
+
+func TestNode_PeerIsBannedAfterMisbehaving(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	peer := NewPeerNode("127.0.0.1", 8086, false, database.NewAccount(""), true)
+
+	n := New(newTestConfig(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), []PeerNode{peer}), logger.Discard())
+
+	invalidBlockErr := newPeerMisbehaviourErr(
+		peerPenaltyInvalidBlock, fmt.Errorf("invalid block"))
+
+	n.penalizePeer(peer, invalidBlockErr)
+	if n.knownPeers[peer.TcpAddress()].score != -peerPenaltyInvalidBlock {
+		t.Fatal("peer serving an invalid block should be penalized")
+	}
+
+	n.rewardPeer(peer)
+	if n.knownPeers[peer.TcpAddress()].score != -peerPenaltyInvalidBlock+peerRewardGoodRes {
+		t.Fatal("peer answering properly should be rewarded")
+	}
+
+	for n.IsKnownPeer(peer) {
+		n.penalizePeer(peer, invalidBlockErr)
+	}
+
+	if !n.IsBannedPeer(peer) {
+		t.Fatal("peer dropping below the score threshold should be banned")
+	}
+
+	bannedPeers, err := LoadBannedPeers(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, isBanned := bannedPeers[peer.TcpAddress()]; !isBanned {
+		t.Fatal("banned peer should be persisted in the data dir")
+	}
+}
+
+func TestNode_PeerIsNotPenalizedForRateLimiting(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	peer := NewPeerNode("127.0.0.1", 8086, false, database.NewAccount(""), true)
+
+	n := New(newTestConfig(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), []PeerNode{peer}), logger.Discard())
+
+	n.penalizePeer(peer, &client.APIError{StatusCode: http.StatusTooManyRequests, Message: "too many requests"})
+	if n.knownPeers[peer.TcpAddress()].score != 0 {
+		t.Fatal("peer refusing requests over its rate limit should not be penalized")
+	}
+
+	n.penalizePeer(peer, &client.APIError{StatusCode: http.StatusInternalServerError})
+	if n.knownPeers[peer.TcpAddress()].score != -peerPenaltyTimeout {
+		t.Fatal("peer failing requests should be penalized")
+	}
+}
+
+func TestNode_PeerBanExpires(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	peer := NewPeerNode("127.0.0.1", 8086, false, database.NewAccount(""), true)
+
+	cfg := newTestConfig(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), []PeerNode{peer})
+	cfg.PeerBanDuration = 0
+
+	n := New(cfg, logger.Discard())
+	n.banPeer(peer, "test")
+
+	if n.IsBannedPeer(peer) {
+		t.Fatal("peer ban should have expired")
+	}
+}
+
+func TestParseBootnode(t *testing.T) {
+	peer, err := ParseBootnode(testKsSimoneAccount + "@10.0.0.1:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peer.IP != "10.0.0.1" || peer.Port != 8080 || !peer.IsBootstrap {
+		t.Fatalf("unexpected bootnode %+v", peer)
+	}
+
+	if peer.Account != database.NewAccount(testKsSimoneAccount) {
+		t.Fatal("bootnode account should be parsed")
+	}
+
+	peer, err = ParseBootnode("10.0.0.2:8081")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peer.TcpAddress() != "10.0.0.2:8081" {
+		t.Fatalf("unexpected bootnode address %s", peer.TcpAddress())
+	}
+
+	for _, raw := range []string{"10.0.0.1", "10.0.0.1:port", "nope@10.0.0.1:8080"} {
+		_, err = ParseBootnode(raw)
+		if err == nil {
+			t.Fatalf("bootnode '%s' should be invalid", raw)
+		}
+	}
+}
+
+func TestNode_KnownPeersArePersisted(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(newTestConfig(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), []PeerNode{}), logger.Discard())
+
+	peer := NewPeerNode("127.0.0.1", 8086, false, database.NewAccount(""), true)
+	n.AddPeer(peer)
+
+	knownPeers, err := LoadKnownPeers(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, isKnownPeer := knownPeers[peer.TcpAddress()]; !isKnownPeer {
+		t.Fatal("added peer should be persisted in the data dir")
+	}
+
+	n.RemovePeer(peer)
+
+	knownPeers, err = LoadKnownPeers(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(knownPeers) != 0 {
+		t.Fatal("removed peer should be removed from the data dir")
+	}
+}
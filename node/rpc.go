@@ -0,0 +1,308 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+)
+
+const endpointRPC = "/rpc"
+
+const rpcVersion = "2.0"
+
+// JSON-RPC 2.0 error codes, see https://www.jsonrpc.org/specification
+const rpcErrCodeParse = -32700
+const rpcErrCodeInvalidRequest = -32600
+const rpcErrCodeMethodNotFound = -32601
+const rpcErrCodeInvalidParams = -32602
+const rpcErrCodeInternal = -32603
+
+// rpcErrCodeRejected reports a valid request the node refused,
+// e.g. a TX with a forged signature.
+const rpcErrCodeRejected = -32000
+
+const rpcBlockLatest = "latest"
+
+type RPCReq struct {
+	JsonRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type RPCRes struct {
+	JsonRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCErr         `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type RPCErr struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCErr) Error() string {
+	return e.Message
+}
+
+func newRPCErr(code int, err error) *RPCErr {
+	return &RPCErr{code, err.Error()}
+}
+
+type rpcMethod func(n *Node, params json.RawMessage) (interface{}, *RPCErr)
+
+var rpcMethods = map[string]rpcMethod{
+	"sb_blockNumber":         rpcBlockNumber,
+	"sb_getBalance":          rpcGetBalance,
+	"sb_getBlockByNumber":    rpcGetBlockByNumber,
+	"sb_getBlockByHash":      rpcGetBlockByHash,
+	"sb_getTransaction":      rpcGetTransaction,
+	"sb_sendRawTransaction":  rpcSendRawTransaction,
+	"sb_pendingTransactions": rpcPendingTransactions,
+}
+
+// rpcHandler serves JSON-RPC 2.0 requests, single or batched, reusing
+// the logic of the REST handlers.
+func rpcHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodPost) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if errors.Is(err, errReqBodyTooLarge) {
+		writeErrResWithStatus(w, err, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeRes(w, newRPCErrRes(nil, newRPCErr(rpcErrCodeParse, err)))
+		return
+	}
+	defer r.Body.Close()
+
+	body = bytes.TrimSpace(body)
+
+	if len(body) == 0 || body[0] != '[' {
+		res, isNotification := node.serveRPC(body)
+		if isNotification {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeRes(w, res)
+		return
+	}
+
+	var batch []json.RawMessage
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		writeRes(w, newRPCErrRes(nil, newRPCErr(rpcErrCodeParse, err)))
+		return
+	}
+
+	if len(batch) == 0 {
+		writeRes(w, newRPCErrRes(nil, &RPCErr{rpcErrCodeInvalidRequest, "empty batch"}))
+		return
+	}
+
+	responses := make([]RPCRes, 0, len(batch))
+	for _, rawReq := range batch {
+		res, isNotification := node.serveRPC(rawReq)
+		if !isNotification {
+			responses = append(responses, res)
+		}
+	}
+
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeRes(w, responses)
+}
+
+// serveRPC runs a single request, reporting whether it was a notification
+// the client expects no response to.
+func (n *Node) serveRPC(rawReq json.RawMessage) (RPCRes, bool) {
+	req := RPCReq{}
+	err := json.Unmarshal(rawReq, &req)
+	if err != nil {
+		return newRPCErrRes(nil, newRPCErr(rpcErrCodeParse, err)), false
+	}
+
+	if req.JsonRPC != rpcVersion || req.Method == "" {
+		return newRPCErrRes(req.ID, &RPCErr{
+			rpcErrCodeInvalidRequest, "invalid JSON-RPC 2.0 request"}), false
+	}
+
+	isNotification := len(req.ID) == 0
+
+	method, isKnown := rpcMethods[req.Method]
+	if !isKnown {
+		return newRPCErrRes(req.ID, &RPCErr{
+			rpcErrCodeMethodNotFound,
+			fmt.Sprintf("method '%s' not found", req.Method)}), isNotification
+	}
+
+	result, rpcErr := method(n, req.Params)
+	if rpcErr != nil {
+		return newRPCErrRes(req.ID, rpcErr), isNotification
+	}
+
+	return RPCRes{JsonRPC: rpcVersion, Result: result, ID: req.ID}, isNotification
+}
+
+func newRPCErrRes(id json.RawMessage, rpcErr *RPCErr) RPCRes {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	return RPCRes{JsonRPC: rpcVersion, Error: rpcErr, ID: id}
+}
+
+// readRPCParams decodes the positional `params` array into `args`.
+func readRPCParams(params json.RawMessage, args ...interface{}) *RPCErr {
+	var rawArgs []json.RawMessage
+
+	if len(params) > 0 {
+		err := json.Unmarshal(params, &rawArgs)
+		if err != nil {
+			return newRPCErr(rpcErrCodeInvalidParams, err)
+		}
+	}
+
+	if len(rawArgs) != len(args) {
+		return &RPCErr{
+			rpcErrCodeInvalidParams,
+			fmt.Sprintf("expected %d params, got %d", len(args), len(rawArgs))}
+	}
+
+	for i, rawArg := range rawArgs {
+		err := json.Unmarshal(rawArg, args[i])
+		if err != nil {
+			return newRPCErr(rpcErrCodeInvalidParams, err)
+		}
+	}
+
+	return nil
+}
+
+func rpcBlockNumber(n *Node, params json.RawMessage) (interface{}, *RPCErr) {
+	if rpcErr := readRPCParams(params); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return n.state.LatestBlock().Header.Number, nil
+}
+
+func rpcGetBalance(n *Node, params json.RawMessage) (interface{}, *RPCErr) {
+	var account string
+	if rpcErr := readRPCParams(params, &account); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if !common.IsHexAddress(account) {
+		return nil, &RPCErr{
+			rpcErrCodeInvalidParams, fmt.Sprintf("'%s' is an invalid account", account)}
+	}
+
+	return n.state.Balance(database.NewAccount(account)), nil
+}
+
+// rpcGetBlockByNumber accepts a block number or "latest".
+func rpcGetBlockByNumber(n *Node, params json.RawMessage) (interface{}, *RPCErr) {
+	var rawNumber json.RawMessage
+	if rpcErr := readRPCParams(params, &rawNumber); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	var res BlockRes
+	var isFound bool
+	var err error
+
+	if string(rawNumber) == strconv.Quote(rpcBlockLatest) {
+		res, isFound, err = n.latestBlockRes()
+	} else {
+		var number uint64
+		err = json.Unmarshal(rawNumber, &number)
+		if err != nil {
+			return nil, &RPCErr{
+				rpcErrCodeInvalidParams,
+				fmt.Sprintf("'%s' is neither a block number nor '%s'", rawNumber, rpcBlockLatest)}
+		}
+
+		res, isFound, err = n.blockResByNumber(number)
+	}
+
+	return blockResult(res, isFound, err)
+}
+
+func rpcGetBlockByHash(n *Node, params json.RawMessage) (interface{}, *RPCErr) {
+	var rawHash string
+	if rpcErr := readRPCParams(params, &rawHash); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	hash, err := parseHash(rawHash)
+	if err != nil {
+		return nil, newRPCErr(rpcErrCodeInvalidParams, err)
+	}
+
+	return blockResult(n.blockResByHash(hash))
+}
+
+// blockResult reports a missing block as a null result.
+func blockResult(res BlockRes, isFound bool, err error) (interface{}, *RPCErr) {
+	if err != nil {
+		return nil, newRPCErr(rpcErrCodeInternal, err)
+	}
+
+	if !isFound {
+		return json.RawMessage("null"), nil
+	}
+
+	return res, nil
+}
+
+func rpcGetTransaction(n *Node, params json.RawMessage) (interface{}, *RPCErr) {
+	var rawHash string
+	if rpcErr := readRPCParams(params, &rawHash); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	txHash, err := parseHash(rawHash)
+	if err != nil {
+		return nil, newRPCErr(rpcErrCodeInvalidParams, err)
+	}
+
+	return n.txStatus(txHash), nil
+}
+
+func rpcSendRawTransaction(n *Node, params json.RawMessage) (interface{}, *RPCErr) {
+	signedTx := database.SignedTx{}
+	if rpcErr := readRPCParams(params, &signedTx); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	txHash, err := n.submitSignedTx(signedTx)
+	if err != nil {
+		return nil, newRPCErr(rpcErrCodeRejected, err)
+	}
+
+	return txHash, nil
+}
+
+func rpcPendingTransactions(n *Node, params json.RawMessage) (interface{}, *RPCErr) {
+	if rpcErr := readRPCParams(params); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return n.getPendingTXsAsArray(), nil
+}
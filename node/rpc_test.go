@@ -0,0 +1,113 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+func TestRPCHandler(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithState(t, map[common.Address]uint{sender: 1000})
+
+	res := RPCRes{}
+	rec := postTestRPC(t, n, `{"jsonrpc":"2.0","method":"sb_getBalance","params":["`+sender.Hex()+`"],"id":1}`)
+	decodeTestRPCRes(t, rec, &res)
+
+	if res.Error != nil || res.Result.(float64) != 1000 {
+		t.Fatalf("expected balance 1000, got %+v", res)
+	}
+
+	if string(res.ID) != "1" {
+		t.Fatalf("response should echo the request id, got %s", res.ID)
+	}
+
+	signedTx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""), senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedTxJson, err := json.Marshal(signedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := `[
+		{"jsonrpc":"2.0","method":"sb_sendRawTransaction","params":[` + string(signedTxJson) + `],"id":"send"},
+		{"jsonrpc":"2.0","method":"sb_pendingTransactions","id":"pending"},
+		{"jsonrpc":"2.0","method":"sb_unknown","id":"unknown"},
+		{"jsonrpc":"2.0","method":"sb_blockNumber"}
+	]`
+
+	batchRes := []RPCRes{}
+	decodeTestRPCRes(t, postTestRPC(t, n, batch), &batchRes)
+
+	if len(batchRes) != 3 {
+		t.Fatalf("expected 3 responses, notifications excluded, got %d", len(batchRes))
+	}
+
+	txHash, err := signedTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batchRes[0].Error != nil || batchRes[0].Result.(string) != txHash.Hex() {
+		t.Fatalf("sb_sendRawTransaction should return the TX hash, got %+v", batchRes[0])
+	}
+
+	if pending := batchRes[1].Result.([]interface{}); len(pending) != 1 {
+		t.Fatalf("expected 1 pending TX, got %d", len(pending))
+	}
+
+	if batchRes[2].Error == nil || batchRes[2].Error.Code != rpcErrCodeMethodNotFound {
+		t.Fatalf("unknown method should fail with %d, got %+v", rpcErrCodeMethodNotFound, batchRes[2])
+	}
+
+	rec = postTestRPC(t, n, `{"jsonrpc":"2.0","method":"sb_getBlockByNumber","params":[42],"id":2}`)
+	res = RPCRes{}
+	decodeTestRPCRes(t, rec, &res)
+
+	if res.Error != nil || res.Result != nil {
+		t.Fatalf("missing block should be a null result, got %+v", res)
+	}
+
+	rec = postTestRPC(t, n, `{"jsonrpc":"2.0","method":"sb_blockNumber"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("notification should get no response, got %d", rec.Code)
+	}
+
+	rec = postTestRPC(t, n, `{"jsonrpc":"2.0",`)
+	res = RPCRes{}
+	decodeTestRPCRes(t, rec, &res)
+
+	if res.Error == nil || res.Error.Code != rpcErrCodeParse {
+		t.Fatalf("malformed JSON should fail with %d, got %+v", rpcErrCodeParse, res)
+	}
+}
+
+func postTestRPC(t *testing.T, n *Node, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, endpointRPC, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	rpcHandler(rec, req, n)
+
+	return rec
+}
+
+func decodeTestRPCRes(t *testing.T, rec *httptest.ResponseRecorder, res interface{}) {
+	err := json.Unmarshal(rec.Body.Bytes(), res)
+	if err != nil {
+		t.Fatalf("%s: %s", err, rec.Body.String())
+	}
+}
@@ -2,29 +2,51 @@ package node
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/simone-trubian/blockchain-tutorial/client"
 	"github.com/simone-trubian/blockchain-tutorial/database"
 )
 
+// newPeerHTTPClient builds the client syncing with Peers, giving up on
+// Peers too slow to answer.
+func newPeerHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout:   peerRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
 func (n *Node) sync(ctx context.Context) error {
-	ticker := time.NewTicker(45 * time.Second)
+	ticker := time.NewTicker(n.syncInterval)
+
+	// Catch up right away rather than waiting for the first tick
+	n.doSync(ctx)
 
 	for {
 		select {
 		case <-ticker.C:
-			n.doSync()
+			n.doSync(ctx)
 
 		case <-ctx.Done():
 			ticker.Stop()
+			return nil
 		}
 	}
 }
 
-func (n *Node) doSync() {
-	for _, peer := range n.knownPeers {
+func (n *Node) doSync(ctx context.Context) {
+	statuses := make(map[string]StatusRes)
+	queriedPeers := 0
+
+	for _, peer := range n.knownPeersCopy() {
 		if n.info.IP == peer.IP && n.info.Port == peer.Port {
 			continue
 		}
@@ -33,97 +55,373 @@ func (n *Node) doSync() {
 			continue
 		}
 
-		fmt.Printf(
-			"Searching for new Peers and their Blocks and Peers: '%s'\n",
-			peer.TcpAddress())
+		queriedPeers++
 
-		status, err := queryPeerStatus(peer)
-		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			fmt.Printf(
-				"Peer '%s' was removed from KnownPeers\n",
-				peer.TcpAddress())
+		n.syncLogger.Debug("Querying peer status", "peer", peer.TcpAddress())
 
-			n.RemovePeer(peer)
+		status, err := queryPeerStatus(ctx, n.peerClient, peer)
+		if err != nil {
+			n.syncLogger.Error("Peer status query failed", "peer", peer.TcpAddress(), "err", err)
+			n.penalizePeer(peer, err)
 
 			continue
 		}
 
-		err = n.joinKnownPeers(peer)
+		n.rewardPeer(peer)
+
+		err = n.joinKnownPeers(ctx, peer)
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+			n.syncLogger.Error("Joining peer failed", "peer", peer.TcpAddress(), "err", err)
+			n.penalizePeer(peer, err)
 			continue
 		}
 
-		err = n.syncBlocks(peer, status)
-		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+		statuses[peer.TcpAddress()] = status
+	}
+
+	err := n.syncBlocks(ctx, statuses)
+	if err != nil {
+		n.syncLogger.Error("Blocks sync failed", "err", err)
+	}
+
+	n.syncProgress.record(statuses, queriedPeers, n.knownPeersCopy())
+
+	for tcpAddress, status := range statuses {
+		peer, isKnownPeer := n.knownPeer(tcpAddress)
+
+		// The Peer might have been banned while syncing blocks
+		if !isKnownPeer {
 			continue
 		}
 
 		err = n.syncKnownPeers(status)
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+			n.syncLogger.Error("Known peers sync failed", "peer", tcpAddress, "err", err)
 			continue
 		}
 
 		err = n.syncPendingTXs(peer, status.PendingTXs)
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+			n.syncLogger.Error("Pending TXs sync failed", "peer", tcpAddress, "err", err)
+			n.penalizePeer(peer, err)
 			continue
 		}
 	}
 }
 
-func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
+// syncBlocks imports the blocks the best known peer has ahead of us.
+//
+// The header chain is fetched from the best peer first and its seals and
+// linkage verified, the headers committing to their TXs through their TX
+// root. The block bodies are then downloaded in parallel from every peer
+// claiming to have them, and verified against the headers.
+//
+// Peers serving invalid headers, blocks or failing to answer are penalized.
+// The ones whose claims are disproved, serving invalid headers or blocks,
+// or fewer blocks than their status claimed, are dropped from `statuses`.
+func (n *Node) syncBlocks(ctx context.Context, statuses map[string]StatusRes) error {
+	bestPeer, bestStatus, found := n.findBestPeer(statuses)
+	if !found {
+		return nil
+	}
+
 	localBlockNumber := n.state.LatestBlock().Header.Number
 
-	// If the peer has no blocks, ignore it
-	if status.Hash.IsEmpty() {
-		return nil
+	// Display found 1 new block if we sync the genesis block 0
+	newBlocksCount := bestStatus.Number - localBlockNumber
+	if n.state.LatestBlockHash().IsEmpty() {
+		newBlocksCount = bestStatus.Number + 1
 	}
+	n.syncLogger.Info(
+		"Found new blocks", "count", newBlocksCount, "peer", bestPeer.TcpAddress())
 
-	// If the peer has less blocks than us, ignore it
-	if status.Number < localBlockNumber {
-		return nil
+	for {
+		fromBlock := n.state.LatestBlockHash()
+
+		n.syncLogger.Debug(
+			"Importing headers", "after", fromBlock.Hex(), "peer", bestPeer.TcpAddress())
+
+		headersRes, err := bestPeer.apiClient(n.peerClient).HeadersAfter(
+			ctx, fromBlock, syncMaxBlocksPerPage)
+		if err != nil {
+			n.penalizePeer(bestPeer, err)
+			return err
+		}
+
+		if len(headersRes.Headers) == 0 {
+			break
+		}
+
+		err = database.VerifyHeaderChain(
+			fromBlock, n.state.NextBlockNumber(), headersRes.Headers, n.consensus)
+		if err != nil {
+			err = newPeerMisbehaviourErr(peerPenaltyInvalidBlock, fmt.Errorf(
+				"Peer '%s' served an invalid header chain. %s",
+				bestPeer.TcpAddress(),
+				err.Error()))
+			n.penalizePeer(bestPeer, err)
+			n.distrustPeer(statuses, bestPeer)
+
+			return err
+		}
+
+		lastHeader := headersRes.Headers[len(headersRes.Headers)-1]
+		peers := peersHavingBlock(n.knownPeersCopy(), statuses, lastHeader.Value.Number)
+		peers = append([]PeerNode{bestPeer}, peers...)
+
+		blocks, failures, err := downloadBlocks(
+			ctx, n.peerClient, peers, fromBlock, headersRes.Headers, n.syncLogger)
+		for tcpAddress, failure := range failures {
+			peer, isKnownPeer := n.knownPeer(tcpAddress)
+			if !isKnownPeer {
+				continue
+			}
+
+			n.penalizePeer(peer, failure)
+
+			var misbehaviourErr peerMisbehaviourErr
+			if errors.As(failure, &misbehaviourErr) {
+				n.distrustPeer(statuses, peer)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			err = n.addBlock(block)
+			if errors.Is(err, database.ErrBlockNotNext) {
+				// The node mined or was submitted a block meanwhile, the
+				// Peer is not to blame
+				return err
+			}
+			if err != nil {
+				// The blocks match the headers served by the best Peer
+				n.penalizePeer(
+					bestPeer, newPeerMisbehaviourErr(peerPenaltyInvalidBlock, err))
+				n.distrustPeer(statuses, bestPeer)
+
+				return err
+			}
+
+			// The miner stops listening once the node is shutting down
+			select {
+			case n.newSyncedBlocks <- block:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if !headersRes.HasMore {
+			break
+		}
 	}
 
-	// If it's the genesis block and we already synced it, ignore it
-	if status.Number == 0 && !n.state.LatestBlockHash().IsEmpty() {
-		return nil
+	if n.state.LatestBlockHash().IsEmpty() || n.state.LatestBlock().Header.Number < bestStatus.Number {
+		err := newPeerMisbehaviourErr(peerPenaltyMalformedRes, fmt.Errorf(
+			"Peer '%s' claimed block %d but served no more blocks",
+			bestPeer.TcpAddress(),
+			bestStatus.Number))
+		n.penalizePeer(bestPeer, err)
+		n.distrustPeer(statuses, bestPeer)
+
+		return err
 	}
 
-	// Display found 1 new block if we sync the genesis block 0
-	newBlocksCount := status.Number - localBlockNumber
-	if localBlockNumber == 0 && status.Number == 0 {
-		newBlocksCount = 1
+	return nil
+}
+
+// distrustPeer drops the `peer` status and its last known height, its
+// claims about its chain being disproved.
+func (n *Node) distrustPeer(statuses map[string]StatusRes, peer PeerNode) {
+	delete(statuses, peer.TcpAddress())
+	n.syncProgress.forget(peer.TcpAddress())
+}
+
+// findBestPeer picks the peer claiming the highest chain, ignoring peers
+// with no blocks or no more blocks than us.
+func (n *Node) findBestPeer(
+	statuses map[string]StatusRes) (PeerNode, StatusRes, bool) {
+	localBlockNumber := n.state.LatestBlock().Header.Number
+	hasLocalBlocks := !n.state.LatestBlockHash().IsEmpty()
+
+	var bestPeer PeerNode
+	var bestStatus StatusRes
+	found := false
+
+	for tcpAddress, status := range statuses {
+		// If the peer has no blocks, ignore it
+		if status.Hash.IsEmpty() {
+			continue
+		}
+
+		// If the peer doesn't have more blocks than us, ignore it
+		if hasLocalBlocks && status.Number <= localBlockNumber {
+			continue
+		}
+
+		if !found || status.Number > bestStatus.Number {
+			bestPeer, _ = n.knownPeer(tcpAddress)
+			bestStatus = status
+			found = true
+		}
+	}
+
+	return bestPeer, bestStatus, found
+}
+
+func peersHavingBlock(
+	knownPeers map[string]PeerNode,
+	statuses map[string]StatusRes,
+	number uint64) []PeerNode {
+	peers := make([]PeerNode, 0)
+
+	for tcpAddress, status := range statuses {
+		if status.Hash.IsEmpty() || status.Number < number {
+			continue
+		}
+
+		peers = append(peers, knownPeers[tcpAddress])
 	}
-	fmt.Printf(
-		"Found %d new blocks from Peer %s\n",
-		newBlocksCount,
-		peer.TcpAddress())
 
-	blocks, err := fetchBlocksFromPeer(peer, n.state.LatestBlockHash())
+	return peers
+}
+
+type blocksDownload struct {
+	index     int
+	fromBlock database.Hash
+	headers   []database.BlockHeaderFS
+}
+
+// downloadBlocks fetches the blocks described by the verified `headers`
+// in chunks spread across `peers`.
+//
+// A peer failing to serve a chunk, or serving blocks not matching the
+// headers, is dropped from the download and its chunk handed to another.
+// The peers failures are returned by their TCP address.
+func downloadBlocks(
+	ctx context.Context,
+	httpClient *http.Client,
+	peers []PeerNode,
+	fromBlock database.Hash,
+	headers []database.BlockHeaderFS,
+	logger log.Logger) ([]database.Block, map[string]error, error) {
+	chunksCount := (len(headers) + syncBlocksPerDownload - 1) / syncBlocksPerDownload
+	downloads := make(chan blocksDownload, chunksCount)
+	chunks := make([][]database.Block, chunksCount)
+
+	for i := 0; i < chunksCount; i++ {
+		start := i * syncBlocksPerDownload
+		end := start + syncBlocksPerDownload
+		if end > len(headers) {
+			end = len(headers)
+		}
+
+		chunkFromBlock := fromBlock
+		if start > 0 {
+			chunkFromBlock = headers[start-1].Key
+		}
+
+		downloads <- blocksDownload{i, chunkFromBlock, headers[start:end]}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	remaining := chunksCount
+	usedPeers := make(map[string]bool)
+	failures := make(map[string]error)
+
+	for _, peer := range peers {
+		if usedPeers[peer.TcpAddress()] || len(usedPeers) == syncMaxParallelDownloads {
+			continue
+		}
+		usedPeers[peer.TcpAddress()] = true
+
+		wg.Add(1)
+		go func(peer PeerNode) {
+			defer wg.Done()
+
+			for download := range downloads {
+				logger.Debug(
+					"Importing blocks", "after", download.fromBlock.Hex(), "peer", peer.TcpAddress())
+
+				blocks, err := fetchVerifiedBlocksFromPeer(ctx, httpClient, peer, download)
+				if err != nil {
+					logger.Error("Blocks download failed", "peer", peer.TcpAddress(), "err", err)
+
+					mu.Lock()
+					failures[peer.TcpAddress()] = err
+					mu.Unlock()
+
+					// Let a healthier peer retry the chunk
+					downloads <- download
+					return
+				}
+
+				mu.Lock()
+				chunks[download.index] = blocks
+				remaining--
+				if remaining == 0 {
+					close(downloads)
+				}
+				mu.Unlock()
+			}
+		}(peer)
+	}
+
+	wg.Wait()
+
+	if remaining > 0 {
+		return nil, failures, fmt.Errorf(
+			"unable to download %d blocks chunks from any Peer", remaining)
+	}
+
+	blocks := make([]database.Block, 0, len(headers))
+	for _, chunk := range chunks {
+		blocks = append(blocks, chunk...)
+	}
+
+	return blocks, failures, nil
+}
+
+func fetchVerifiedBlocksFromPeer(
+	ctx context.Context,
+	httpClient *http.Client,
+	peer PeerNode,
+	download blocksDownload) ([]database.Block, error) {
+	syncRes, err := peer.apiClient(httpClient).BlocksAfter(
+		ctx, download.fromBlock, len(download.headers))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if len(syncRes.Blocks) != len(download.headers) {
+		return nil, newPeerMisbehaviourErr(peerPenaltyInvalidBlock, fmt.Errorf(
+			"Peer '%s' served %d blocks instead of %d",
+			peer.TcpAddress(),
+			len(syncRes.Blocks),
+			len(download.headers)))
 	}
 
-	for _, block := range blocks {
-		_, err = n.state.AddBlock(block)
+	for i, block := range syncRes.Blocks {
+		err = database.VerifyBlockAgainstHeader(block, download.headers[i])
 		if err != nil {
-			return err
+			return nil, newPeerMisbehaviourErr(peerPenaltyInvalidBlock, fmt.Errorf(
+				"Peer '%s' served an invalid block. %s",
+				peer.TcpAddress(),
+				err.Error()))
 		}
-
-		n.newSyncedBlocks <- block
 	}
 
-	return nil
+	return syncRes.Blocks, nil
 }
 
 func (n *Node) syncKnownPeers(status StatusRes) error {
-	for _, statusPeer := range status.KnownPeers {
-		if !n.IsKnownPeer(statusPeer) {
-			fmt.Printf("Found new Peer %s\n", statusPeer.TcpAddress())
+	for _, advertisedPeer := range status.KnownPeers {
+		statusPeer := newPeerNodeFromClient(advertisedPeer)
+
+		if !n.IsKnownPeer(statusPeer) && !n.IsBannedPeer(statusPeer) {
+			n.syncLogger.Info("Found new peer", "peer", statusPeer.TcpAddress())
 
 			n.AddPeer(statusPeer)
 		}
@@ -134,7 +432,27 @@ func (n *Node) syncKnownPeers(status StatusRes) error {
 
 func (n *Node) syncPendingTXs(peer PeerNode, txs []database.SignedTx) error {
 	for _, tx := range txs {
-		err := n.AddPendingTX(tx, peer)
+		isAuthentic, err := tx.IsAuthentic()
+		if err != nil {
+			return newPeerMisbehaviourErr(peerPenaltyInvalidTx, err)
+		}
+
+		if !isAuthentic {
+			return newPeerMisbehaviourErr(peerPenaltyInvalidTx, fmt.Errorf(
+				"wrong TX. Sender '%s' is forged", tx.From.String()))
+		}
+
+		txHash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+
+		// The Peer may not have mined the block including it yet
+		if _, isIncluded := n.state.GetTxIndexEntry(txHash); isIncluded {
+			continue
+		}
+
+		err = n.AddPendingTX(tx, peer)
 		if err != nil {
 			return err
 		}
@@ -143,28 +461,53 @@ func (n *Node) syncPendingTXs(peer PeerNode, txs []database.SignedTx) error {
 	return nil
 }
 
-func (n *Node) joinKnownPeers(peer PeerNode) error {
+// joinKnownPeers registers this node into the Peer KnownPeers through
+// the signed handshake, verifying the Peer identity along the way.
+func (n *Node) joinKnownPeers(ctx context.Context, peer PeerNode) error {
 	if peer.connected {
 		return nil
 	}
 
-	url := fmt.Sprintf(
-		"http://%s%s?%s=%s&%s=%d",
-		peer.TcpAddress(),
-		endpointAddPeer,
-		endpointAddPeerQueryKeyIP,
-		n.info.IP,
-		endpointAddPeerQueryKeyPort,
-		n.info.Port,
-	)
+	challenge, err := newHandshakeChallenge()
+	if err != nil {
+		return err
+	}
+
+	handshakeRes, err := peer.apiClient(n.peerClient).Handshake(
+		ctx, challenge, n.info.IP, n.info.Port)
+	if err != nil {
+		return err
+	}
+
+	err = verifyHandshake(
+		challenge, n.info.TcpAddress(), handshakeRes.Sig, handshakeRes.Account)
+	if err != nil {
+		return newPeerMisbehaviourErr(peerPenaltyInvalidHandshake, fmt.Errorf(
+			"Peer '%s' handshake is invalid. %s", peer.TcpAddress(), err.Error()))
+	}
+
+	// A Peer without a configured account is trusted on the first handshake
+	if peer.Account != (common.Address{}) && peer.Account != handshakeRes.Account {
+		return newPeerMisbehaviourErr(peerPenaltyInvalidHandshake, fmt.Errorf(
+			"Peer '%s' is '%s' instead of '%s'",
+			peer.TcpAddress(),
+			handshakeRes.Account.String(),
+			peer.Account.String()))
+	}
 
-	res, err := http.Get(url)
+	sig, err := n.signHandshake(handshakeRes.Challenge, n.info.TcpAddress())
 	if err != nil {
 		return err
 	}
 
-	addPeerRes := AddPeerRes{}
-	err = readRes(res, &addPeerRes)
+	addPeerRes, err := peer.apiClient(n.peerClient).PeerAdd(ctx, client.PeerAddReq{
+		IP:        n.info.IP,
+		Port:      n.info.Port,
+		Account:   n.info.Account,
+		Challenge: handshakeRes.Challenge,
+		Sig:       sig,
+		TLS:       n.info.TLS,
+	})
 	if err != nil {
 		return err
 	}
@@ -172,10 +515,13 @@ func (n *Node) joinKnownPeers(peer PeerNode) error {
 		return fmt.Errorf(addPeerRes.Error)
 	}
 
+	n.peersMu.Lock()
 	knownPeer := n.knownPeers[peer.TcpAddress()]
+	knownPeer.Account = handshakeRes.Account
 	knownPeer.connected = addPeerRes.Success
 
-	n.AddPeer(knownPeer)
+	n.addKnownPeer(knownPeer)
+	n.peersMu.Unlock()
 
 	if !addPeerRes.Success {
 		return fmt.Errorf("unable to join KnownPeers of '%s'", peer.TcpAddress())
@@ -184,45 +530,7 @@ func (n *Node) joinKnownPeers(peer PeerNode) error {
 	return nil
 }
 
-func queryPeerStatus(peer PeerNode) (StatusRes, error) {
-	url := fmt.Sprintf("http://%s%s", peer.TcpAddress(), endpointStatus)
-	res, err := http.Get(url)
-	if err != nil {
-		return StatusRes{}, err
-	}
-
-	statusRes := StatusRes{}
-	err = readRes(res, &statusRes)
-	if err != nil {
-		return StatusRes{}, err
-	}
-
-	return statusRes, nil
-}
-
-func fetchBlocksFromPeer(
-	peer PeerNode,
-	fromBlock database.Hash) ([]database.Block, error) {
-	fmt.Printf("Importing blocks from Peer %s...\n", peer.TcpAddress())
-
-	url := fmt.Sprintf(
-		"http://%s%s?%s=%s",
-		peer.TcpAddress(),
-		endpointSync,
-		endpointSyncQueryKeyFromBlock,
-		fromBlock.Hex(),
-	)
-
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-
-	syncRes := SyncRes{}
-	err = readRes(res, &syncRes)
-	if err != nil {
-		return nil, err
-	}
-
-	return syncRes.Blocks, nil
+func queryPeerStatus(
+	ctx context.Context, httpClient *http.Client, peer PeerNode) (StatusRes, error) {
+	return peer.apiClient(httpClient).Status(ctx)
 }
@@ -0,0 +1,223 @@
+package node
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+)
+
+func TestDownloadBlocksSkipsPeersServingInvalidBlocks(t *testing.T) {
+	blocks, headers := createTestChain(t, syncBlocksPerDownload*3)
+
+	tampered := make([]database.Block, len(blocks))
+	copy(tampered, blocks)
+	tampered[len(tampered)-1].Header.Time++
+
+	honestPeer := startTestSyncPeer(t, blocks)
+	maliciousPeer := startTestSyncPeer(t, tampered)
+
+	downloaded, _, err := downloadBlocks(
+		context.Background(), newPeerHTTPClient(nil), []PeerNode{maliciousPeer, honestPeer}, database.Hash{}, headers, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(downloaded) != len(blocks) {
+		t.Fatalf("expected %d blocks, got %d", len(blocks), len(downloaded))
+	}
+
+	for i, block := range downloaded {
+		err = database.VerifyBlockAgainstHeader(block, headers[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDownloadBlocksFailsWithoutHonestPeers(t *testing.T) {
+	blocks, headers := createTestChain(t, 3)
+
+	tampered := make([]database.Block, len(blocks))
+	copy(tampered, blocks)
+	tampered[0].Header.Time++
+
+	maliciousPeer := startTestSyncPeer(t, tampered)
+
+	_, failures, err := downloadBlocks(
+		context.Background(), newPeerHTTPClient(nil), []PeerNode{maliciousPeer}, database.Hash{}, headers, logger.Discard())
+	if err == nil {
+		t.Fatal("download from a peer serving invalid blocks should fail")
+	}
+
+	if penaltyFor(failures[maliciousPeer.TcpAddress()]) != peerPenaltyInvalidBlock {
+		t.Fatal("peer serving invalid blocks should be penalized as such")
+	}
+}
+
+func TestNode_SyncBlocksVerifiesHeaderSeals(t *testing.T) {
+	// The headers are linked, but the blocks are not mined
+	blocks, headers := createTestChain(t, 3)
+
+	var isDownloaded int32
+	handler := http.NewServeMux()
+	handler.HandleFunc(endpointHeaders, func(w http.ResponseWriter, r *http.Request) {
+		writeRes(w, HeadersRes{Headers: headers})
+	})
+	handler.HandleFunc(endpointSync, func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&isDownloaded, 1)
+		writeRes(w, SyncRes{Blocks: blocks})
+	})
+
+	peer := startTestPeerServer(t, handler)
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	n.AddPeer(peer)
+
+	last := headers[len(headers)-1]
+	statuses := map[string]StatusRes{
+		peer.TcpAddress(): {Hash: last.Key, Number: last.Value.Number},
+	}
+
+	err := n.syncBlocks(context.Background(), statuses)
+	if err == nil {
+		t.Fatal("headers not sealed following the consensus rules should be rejected")
+	}
+
+	if atomic.LoadInt32(&isDownloaded) != 0 {
+		t.Fatal("blocks of headers not sealed should not be downloaded")
+	}
+
+	if n.state.NextBlockNumber() != 0 {
+		t.Fatal("no block should be added")
+	}
+
+	if knownPeer, _ := n.knownPeer(peer.TcpAddress()); knownPeer.score != -peerPenaltyInvalidBlock {
+		t.Fatalf("peer serving unsealed headers should be penalized, score is %d", knownPeer.score)
+	}
+
+	if _, isTrusted := statuses[peer.TcpAddress()]; isTrusted {
+		t.Fatal("status of the peer serving unsealed headers should be dropped")
+	}
+}
+
+func TestNode_SyncBlocksDistrustsOverstatedHeight(t *testing.T) {
+	peer := startTestSyncPeer(t, []database.Block{})
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	n.AddPeer(peer)
+
+	statuses := map[string]StatusRes{
+		peer.TcpAddress(): {Hash: database.Hash{1}, Number: 1000000},
+	}
+	n.syncProgress.record(statuses, 1, n.knownPeersCopy())
+
+	err := n.syncBlocks(context.Background(), statuses)
+	if err == nil {
+		t.Fatal("peer serving no blocks past its claimed height should fail the sync")
+	}
+
+	if knownPeer, _ := n.knownPeer(peer.TcpAddress()); knownPeer.score != -peerPenaltyMalformedRes {
+		t.Fatalf("peer overstating its height should be penalized, score is %d", knownPeer.score)
+	}
+
+	if _, isTrusted := statuses[peer.TcpAddress()]; isTrusted {
+		t.Fatal("status of the peer overstating its height should be dropped")
+	}
+
+	if n.syncProgress.snapshot().hasBestPeer {
+		t.Fatal("height of the peer overstating it should be forgotten")
+	}
+}
+
+// createTestChain builds linked blocks without mining them, which is enough
+// to exercise downloads as VerifyBlockAgainstHeader doesn't check seals.
+func createTestChain(
+	t *testing.T, count int) ([]database.Block, []database.BlockHeaderFS) {
+	blocks := make([]database.Block, 0, count)
+	headers := make([]database.BlockHeaderFS, 0, count)
+	parent := database.Hash{}
+
+	for i := 0; i < count; i++ {
+		b := database.NewBlock(
+			parent, uint64(i), 0, uint64(i), database.NewAccount(DefaultMiner), nil)
+		hash, err := b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blocks = append(blocks, b)
+		headers = append(headers, database.BlockHeaderFS{Key: hash, Value: b.Header})
+		parent = hash
+	}
+
+	return blocks, headers
+}
+
+// startTestSyncPeer serves the /node/sync and /node/headers endpoints from
+// the given blocks.
+func startTestSyncPeer(t *testing.T, blocks []database.Block) PeerNode {
+	handler := http.NewServeMux()
+	handler.HandleFunc(endpointHeaders, func(w http.ResponseWriter, r *http.Request) {
+		headers := make([]database.BlockHeaderFS, 0, len(blocks))
+		for _, b := range blocks {
+			blockHash, _ := b.Hash()
+			headers = append(headers, database.BlockHeaderFS{Key: blockHash, Value: b.Header})
+		}
+
+		writeRes(w, HeadersRes{Headers: headers})
+	})
+	handler.HandleFunc(endpointSync, func(w http.ResponseWriter, r *http.Request) {
+		hash, limit, err := readSyncQuery(r)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		start := 0
+		if !hash.IsEmpty() {
+			for i, b := range blocks {
+				blockHash, _ := b.Hash()
+				if blockHash == hash {
+					start = i + 1
+				}
+			}
+		}
+
+		end := start + limit
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+
+		writeRes(w, SyncRes{Blocks: blocks[start:end], HasMore: end < len(blocks)})
+	})
+
+	return startTestPeerServer(t, handler)
+}
+
+// startTestPeerServer serves the handler as a Peer listening on localhost.
+func startTestPeerServer(t *testing.T, handler http.Handler) PeerNode {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return peerNodeFromTestServer(t, server)
+}
+
+func peerNodeFromTestServer(t *testing.T, server *httptest.Server) PeerNode {
+	host, portRaw, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.ParseUint(portRaw, 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPeerNode(host, port, false, database.NewAccount(""), true)
+}
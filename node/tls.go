@@ -0,0 +1,134 @@
+package node
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const tlsDirName = "tls"
+const tlsCertFileName = "node.crt"
+const tlsKeyFileName = "node.key"
+const tlsCAFileName = "ca.crt"
+
+// TLSConfig enables HTTPS on the node API, using the certificate and key
+// stored in the data dir `tls` folder.
+//
+// With Mutual enabled, Peers must present a certificate signed by the
+// `tls/ca.crt` authority to reach the /node/* endpoints, and this node
+// presents its own certificate when syncing with Peers. Whether enabled or
+// not, the node trusts the `tls/ca.crt` authority, if any, when dialing
+// https Peers.
+type TLSConfig struct {
+	Enabled bool
+	Mutual  bool
+}
+
+func GetTLSDirPath(dataDir string) string {
+	return filepath.Join(dataDir, tlsDirName)
+}
+
+func GetTLSCertFilePath(dataDir string) string {
+	return filepath.Join(GetTLSDirPath(dataDir), tlsCertFileName)
+}
+
+func GetTLSKeyFilePath(dataDir string) string {
+	return filepath.Join(GetTLSDirPath(dataDir), tlsKeyFileName)
+}
+
+func GetTLSCAFilePath(dataDir string) string {
+	return filepath.Join(GetTLSDirPath(dataDir), tlsCAFileName)
+}
+
+// loadTLSConfigs builds the TLS configuration of the node HTTP server,
+// nil unless enabled, and of the HTTP client syncing with Peers.
+func loadTLSConfigs(
+	dataDir string, config TLSConfig) (*tls.Config, *tls.Config, error) {
+	caPool, err := loadTLSCAPool(dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The system authorities are trusted without a CA of the Peers
+	clientConfig := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: caPool}
+
+	if !config.Enabled {
+		return nil, clientConfig, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(
+		GetTLSCertFilePath(dataDir), GetTLSKeyFilePath(dataDir))
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"unable to load the node TLS certificate. %s", err.Error())
+	}
+
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if !config.Mutual {
+		return serverConfig, clientConfig, nil
+	}
+
+	if caPool == nil {
+		return nil, nil, fmt.Errorf(
+			"unable to load the peers TLS certificate authority, '%s' is missing",
+			GetTLSCAFilePath(dataDir))
+	}
+
+	// Wallets and other API clients don't need a certificate,
+	// only Peers do, see requirePeerCert()
+	serverConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	serverConfig.ClientCAs = caPool
+
+	clientConfig.Certificates = []tls.Certificate{cert}
+
+	return serverConfig, clientConfig, nil
+}
+
+// loadTLSCAPool reads the `tls/ca.crt` authority of the Peers, nil if the
+// data dir has none.
+func loadTLSCAPool(dataDir string) (*x509.CertPool, error) {
+	caCert, err := ioutil.ReadFile(GetTLSCAFilePath(dataDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(
+			"unable to load the peers TLS certificate authority. %s", err.Error())
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf(
+			"no certificate found in '%s'", GetTLSCAFilePath(dataDir))
+	}
+
+	return caPool, nil
+}
+
+// requirePeerCert rejects requests to the /node/* endpoints not
+// authenticated by a verified Peer certificate.
+func requirePeerCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isPeerEndpoint := strings.HasPrefix(r.URL.Path, "/node/")
+		hasPeerCert := r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+
+		if isPeerEndpoint && !hasPeerCert {
+			writeErrResWithStatus(
+				w,
+				fmt.Errorf("a verified peer certificate is required"),
+				http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
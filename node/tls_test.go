@@ -0,0 +1,243 @@
+package node
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNode_JoinKnownPeersOverMutualTLS(t *testing.T) {
+	ca, caKey := createTestCA(t)
+	tlsConfig := TLSConfig{Enabled: true, Mutual: true}
+
+	peerNode := newTestHandshakeNode(t, []PeerNode{})
+	writeTestNodeCert(t, peerNode.dataDir, ca, caKey)
+
+	peer, server := startTestTLSPeer(t, peerNode, tlsConfig)
+
+	n := newTestHandshakeNode(t, []PeerNode{peer})
+	writeTestNodeCert(t, n.dataDir, ca, caKey)
+
+	// The Peer dials the node back over mutual TLS too
+	nodePeer, _ := startTestTLSPeer(t, n, tlsConfig)
+	n.info.IP = nodePeer.IP
+	n.info.Port = nodePeer.Port
+	n.info.TLS = true
+
+	_, clientTLSConfig, err := loadTLSConfigs(n.dataDir, tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.peerClient = newPeerHTTPClient(clientTLSConfig)
+
+	_, peerClientTLSConfig, err := loadTLSConfigs(peerNode.dataDir, tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerNode.peerClient = newPeerHTTPClient(peerClientTLSConfig)
+
+	err = n.joinKnownPeers(context.Background(), peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !n.knownPeers[peer.TcpAddress()].connected {
+		t.Fatal("peer should be connected over mutual TLS")
+	}
+
+	// A client trusting the CA but without a certificate isn't a Peer
+	anonymousClient := newPeerHTTPClient(clientTLSConfig.Clone())
+	anonymousClient.Transport.(*http.Transport).TLSClientConfig.Certificates = nil
+
+	res, err := anonymousClient.Get(server.URL + endpointHandshake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("peer endpoints should require a certificate, got status %d", res.StatusCode)
+	}
+}
+
+func TestNode_JoinKnownPeersOverOneWayTLS(t *testing.T) {
+	ca, caKey := createTestCA(t)
+
+	peerNode := newTestHandshakeNode(t, []PeerNode{})
+	writeTestNodeCert(t, peerNode.dataDir, ca, caKey)
+
+	peer, _ := startTestTLSPeer(t, peerNode, TLSConfig{Enabled: true})
+
+	// The node serves plain HTTP, it only trusts the CA of the Peers
+	n := newTestHandshakeNode(t, []PeerNode{peer})
+	serveTestHandshakeNode(t, n)
+
+	_, clientTLSConfig, err := loadTLSConfigs(n.dataDir, TLSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.peerClient = newPeerHTTPClient(clientTLSConfig)
+
+	err = n.joinKnownPeers(context.Background(), peer)
+	if err == nil {
+		t.Fatal("peer certificate shouldn't be trusted without the CA")
+	}
+
+	err = os.MkdirAll(GetTLSDirPath(n.dataDir), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestPem(t, GetTLSCAFilePath(n.dataDir), "CERTIFICATE", ca.Raw)
+
+	_, clientTLSConfig, err = loadTLSConfigs(n.dataDir, TLSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.peerClient = newPeerHTTPClient(clientTLSConfig)
+
+	err = n.joinKnownPeers(context.Background(), peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !n.knownPeers[peer.TcpAddress()].connected {
+		t.Fatal("peer should be connected over one-way TLS")
+	}
+}
+
+func TestParseBootnodeWithTLS(t *testing.T) {
+	peer, err := ParseBootnode("https://" + testKsSimoneAccount + "@10.0.0.1:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !peer.TLS || peer.Url(endpointStatus) != "https://10.0.0.1:8080"+endpointStatus {
+		t.Fatalf("bootnode should be dialed over TLS, got %s", peer.Url(endpointStatus))
+	}
+}
+
+func startTestTLSPeer(
+	t *testing.T, peerNode *Node, tlsConfig TLSConfig) (PeerNode, *httptest.Server) {
+	serverTLSConfig, _, err := loadTLSConfigs(peerNode.dataDir, tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.NewServeMux()
+	handler.HandleFunc(endpointHandshake, func(w http.ResponseWriter, r *http.Request) {
+		handshakeHandler(w, r, peerNode)
+	})
+	handler.HandleFunc(endpointAddPeer, func(w http.ResponseWriter, r *http.Request) {
+		addPeerHandler(w, r, peerNode)
+	})
+
+	var peerHandler http.Handler = handler
+	if tlsConfig.Mutual {
+		peerHandler = requirePeerCert(handler)
+	}
+
+	server := httptest.NewUnstartedServer(peerHandler)
+	server.TLS = serverTLSConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	peer := peerNodeFromTestServer(t, server)
+	peer.Account = peerNode.info.Account
+	peer.IsBootstrap = true
+	peer.TLS = true
+	peer.connected = false
+
+	return peer, server
+}
+
+func createTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sb test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDer, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := x509.ParseCertificate(caDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ca, caKey
+}
+
+// writeTestNodeCert stores a certificate valid for 127.0.0.1 as client
+// and server, signed by the CA, in the node data dir.
+func writeTestNodeCert(
+	t *testing.T, dataDir string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "sb test node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.MkdirAll(GetTLSDirPath(dataDir), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestPem(t, GetTLSCertFilePath(dataDir), "CERTIFICATE", certDer)
+	writeTestPem(t, GetTLSKeyFilePath(dataDir), "EC PRIVATE KEY", keyDer)
+	writeTestPem(t, GetTLSCAFilePath(dataDir), "CERTIFICATE", ca.Raw)
+}
+
+func writeTestPem(t *testing.T, path string, blockType string, der []byte) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	err = pem.Encode(f, &pem.Block{Type: blockType, Bytes: der})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
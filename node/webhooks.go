@@ -0,0 +1,318 @@
+package node
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const endpointAdminWebhookDeliveries = "/admin/webhooks/deliveries"
+const endpointAdminWebhookDeliveriesQueryKeyWebhook = "webhook"
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// keyed with the webhook secret.
+const WebhookSignatureHeader = "X-Sb-Signature"
+
+const webhookMaxAttempts = 5
+const webhookInitialBackoff = time.Second
+const webhookRequestTimeout = 10 * time.Second
+
+// webhookMaxDeliveries bounds the delivery statuses kept in memory.
+const webhookMaxDeliveries = 1000
+
+const WebhookDeliveryPending = "pending"
+const WebhookDeliveryDelivered = "delivered"
+const WebhookDeliveryFailed = "failed"
+
+// Webhook receives the chain Events committed by AddBlock. Empty Events
+// or Addresses match everything, otherwise an Event must be of one of the
+// Events and relate to one of the Addresses (a block relates to its miner
+// and the senders and receivers of its TXs).
+//
+// A Direction narrows the Addresses to the ones receiving funds, with
+// EventDirectionIn, or spending funds, with EventDirectionOut.
+type Webhook struct {
+	ID        string
+	URL       string
+	Secret    string
+	Events    []string
+	Addresses []common.Address
+	Direction string
+}
+
+type WebhookPayload struct {
+	DeliveryID string      `json:"delivery_id"`
+	WebhookID  string      `json:"webhook_id"`
+	Topic      string      `json:"topic"`
+	Data       interface{} `json:"data"`
+	Time       uint64      `json:"time"`
+}
+
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	Topic     string `json:"topic"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	Time      uint64 `json:"time"`
+}
+
+type WebhookDeliveriesRes struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// Validate reports the first invalid setting of the Webhook.
+func (wh Webhook) Validate() error {
+	if wh.ID == "" {
+		return fmt.Errorf("webhook '%s' has no id", wh.URL)
+	}
+
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook '%s' has an invalid url '%s'", wh.ID, wh.URL)
+	}
+
+	for _, event := range wh.Events {
+		if event != EventNewBlock && event != EventBalance {
+			return fmt.Errorf(
+				"webhook '%s' filters on unsupported event '%s'", wh.ID, event)
+		}
+	}
+
+	if wh.Direction != "" && wh.Direction != EventDirectionIn && wh.Direction != EventDirectionOut {
+		return fmt.Errorf(
+			"webhook '%s' has an invalid direction '%s', expected '%s' or '%s'",
+			wh.ID, wh.Direction, EventDirectionIn, EventDirectionOut)
+	}
+	if wh.Direction != "" && len(wh.Addresses) == 0 {
+		return fmt.Errorf("webhook '%s' needs addresses to filter on a direction", wh.ID)
+	}
+
+	return nil
+}
+
+func (wh Webhook) matches(event Event) bool {
+	if len(wh.Events) > 0 && !containsString(wh.Events, event.Topic) {
+		return false
+	}
+
+	if len(wh.Addresses) == 0 {
+		return true
+	}
+
+	watched := make(map[common.Address]bool)
+	for _, address := range wh.Addresses {
+		watched[address] = true
+	}
+
+	return event.relatesTo(watched, wh.Direction)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher POSTs the Events to the matching webhooks, retrying
+// failed deliveries with an exponential backoff.
+type webhookDispatcher struct {
+	webhooks    []Webhook
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	logger      log.Logger
+
+	// stopped is closed on shutdown, abandoning the pending retries
+	stopped  chan struct{}
+	inFlight sync.WaitGroup
+
+	mu         sync.Mutex
+	lastID     uint64
+	deliveries map[string]*WebhookDelivery
+	order      []string
+}
+
+func newWebhookDispatcher(webhooks []Webhook, logger log.Logger) *webhookDispatcher {
+	return &webhookDispatcher{
+		webhooks:    webhooks,
+		client:      &http.Client{Timeout: webhookRequestTimeout},
+		maxAttempts: webhookMaxAttempts,
+		backoff:     webhookInitialBackoff,
+		logger:      logger,
+		stopped:     make(chan struct{}),
+		deliveries:  make(map[string]*WebhookDelivery),
+	}
+}
+
+// publish delivers the `event` in the background.
+func (d *webhookDispatcher) publish(event Event) {
+	for _, webhook := range d.webhooks {
+		if !webhook.matches(event) {
+			continue
+		}
+
+		delivery := d.newDelivery(webhook, event)
+
+		payloadJson, err := json.Marshal(WebhookPayload{
+			delivery.ID, webhook.ID, event.Topic, event.Data, delivery.Time})
+		if err != nil {
+			d.update(delivery.ID, WebhookDeliveryFailed, err)
+			continue
+		}
+
+		d.inFlight.Add(1)
+		go d.deliver(webhook, delivery.ID, payloadJson)
+	}
+}
+
+// stop abandons the pending retries and waits for the ongoing requests.
+func (d *webhookDispatcher) stop() {
+	close(d.stopped)
+	d.inFlight.Wait()
+}
+
+func (d *webhookDispatcher) deliver(webhook Webhook, deliveryID string, payloadJson []byte) {
+	defer d.inFlight.Done()
+
+	backoff := d.backoff
+
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		err := d.post(webhook, payloadJson)
+		if err == nil {
+			d.update(deliveryID, WebhookDeliveryDelivered, nil)
+			return
+		}
+
+		if attempt == d.maxAttempts {
+			d.logger.Error(
+				"Webhook delivery failed", "webhook", webhook.ID, "delivery", deliveryID, "err", err)
+			d.update(deliveryID, WebhookDeliveryFailed, err)
+			return
+		}
+
+		d.update(deliveryID, WebhookDeliveryPending, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-d.stopped:
+			d.logger.Warn(
+				"Webhook delivery abandoned on shutdown", "webhook", webhook.ID, "delivery", deliveryID)
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (d *webhookDispatcher) post(webhook Webhook, payloadJson []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payloadJson))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signWebhookPayload(webhook.Secret, payloadJson))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (d *webhookDispatcher) newDelivery(webhook Webhook, event Event) WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lastID++
+	delivery := &WebhookDelivery{
+		ID:        strconv.FormatUint(d.lastID, 10),
+		WebhookID: webhook.ID,
+		Topic:     event.Topic,
+		Status:    WebhookDeliveryPending,
+		Time:      uint64(time.Now().Unix()),
+	}
+
+	d.deliveries[delivery.ID] = delivery
+	d.order = append(d.order, delivery.ID)
+
+	if len(d.order) > webhookMaxDeliveries {
+		delete(d.deliveries, d.order[0])
+		d.order = d.order[1:]
+	}
+
+	return *delivery
+}
+
+func (d *webhookDispatcher) update(deliveryID string, status string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivery, isKnown := d.deliveries[deliveryID]
+	if !isKnown {
+		return
+	}
+
+	delivery.Status = status
+	delivery.Attempts++
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+}
+
+// Deliveries lists the most recent deliveries first, optionally of a
+// single webhook.
+func (d *webhookDispatcher) Deliveries(webhookID string) []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for i := len(d.order) - 1; i >= 0; i-- {
+		delivery := d.deliveries[d.order[i]]
+		if webhookID == "" || delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+
+	return deliveries
+}
+
+func adminWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !isMethodAllowed(w, r, http.MethodGet) {
+		return
+	}
+
+	webhookID := r.URL.Query().Get(endpointAdminWebhookDeliveriesQueryKeyWebhook)
+
+	writeRes(w, WebhookDeliveriesRes{node.webhooks.Deliveries(webhookID)})
+}
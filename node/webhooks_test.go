@@ -0,0 +1,200 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/logger"
+)
+
+func TestWebhookDeliveryRetriesAndSigns(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	payloads := make([]WebhookPayload, 0)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != signWebhookPayload("secret", body) {
+			t.Errorf("payload should be signed with the webhook secret")
+		}
+
+		// The receiver is down on the first attempt
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		payload := WebhookPayload{}
+		json.Unmarshal(body, &payload)
+		payloads = append(payloads, payload)
+	}))
+	defer receiver.Close()
+
+	miner := database.NewAccount(DefaultMiner)
+	watched := database.NewAccount(testKsTanyaAccount)
+
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	n.webhooks = newWebhookDispatcher([]Webhook{{
+		ID:        "funds",
+		URL:       receiver.URL,
+		Secret:    "secret",
+		Events:    []string{EventBalance},
+		Addresses: []common.Address{watched},
+	}}, logger.Discard())
+	n.webhooks.backoff = time.Millisecond
+
+	tx := database.NewSignedTx(database.NewTx(miner, watched, 10, ""), []byte{})
+	block := database.NewBlock(database.Hash{}, 0, 0, 0, miner, []database.SignedTx{tx})
+	n.publishBlock(database.BlockFS{Key: database.Hash{1}, Value: block})
+
+	deliveries := waitTestWebhookDeliveries(t, n, "funds")
+	if len(deliveries) != 1 {
+		t.Fatalf("only the watched balance change should be delivered, got %d", len(deliveries))
+	}
+
+	if deliveries[0].Status != WebhookDeliveryDelivered || deliveries[0].Attempts != 2 {
+		t.Fatalf("delivery should succeed on the 2nd attempt, got %+v", deliveries[0])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(payloads) != 1 || payloads[0].Topic != EventBalance || payloads[0].DeliveryID != deliveries[0].ID {
+		t.Fatalf("unexpected payloads %+v", payloads)
+	}
+
+	res := WebhookDeliveriesRes{}
+	getTestJson(t, n, adminWebhookDeliveriesHandler, endpointAdminWebhookDeliveries+"?webhook=other", &res)
+	if len(res.Deliveries) != 0 {
+		t.Fatal("deliveries should be filtered by webhook")
+	}
+}
+
+func TestWebhookDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	n.webhooks = newWebhookDispatcher([]Webhook{{ID: "blocks", URL: receiver.URL, Events: []string{EventNewBlock}}}, logger.Discard())
+	n.webhooks.backoff = time.Millisecond
+
+	block := database.NewBlock(database.Hash{}, 0, 0, 0, database.NewAccount(DefaultMiner), nil)
+	n.publishBlock(database.BlockFS{Key: database.Hash{1}, Value: block})
+
+	deliveries := waitTestWebhookDeliveries(t, n, "blocks")
+	if deliveries[0].Status != WebhookDeliveryFailed || deliveries[0].Attempts != webhookMaxAttempts {
+		t.Fatalf("delivery should fail after %d attempts, got %+v", webhookMaxAttempts, deliveries[0])
+	}
+}
+
+func TestWebhookDirection(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	miner := database.NewAccount(DefaultMiner)
+	watched := database.NewAccount(testKsTanyaAccount)
+
+	n := newTestNodeWithState(t, map[common.Address]uint{})
+	n.webhooks = newWebhookDispatcher([]Webhook{
+		{ID: "received", URL: receiver.URL, Events: []string{EventBalance}, Addresses: []common.Address{watched}, Direction: EventDirectionIn},
+		{ID: "spent", URL: receiver.URL, Events: []string{EventBalance}, Addresses: []common.Address{watched}, Direction: EventDirectionOut},
+	}, logger.Discard())
+
+	// The watched account only spends funds
+	tx := database.NewSignedTx(database.NewTx(watched, miner, 10, ""), []byte{})
+	block := database.NewBlock(database.Hash{}, 0, 0, 0, miner, []database.SignedTx{tx})
+	n.publishBlock(database.BlockFS{Key: database.Hash{1}, Value: block})
+
+	if len(waitTestWebhookDeliveries(t, n, "spent")) != 1 {
+		t.Fatal("spending should be delivered to the out webhook")
+	}
+
+	if len(n.webhooks.Deliveries("received")) != 0 {
+		t.Fatal("spending should not be delivered to the in webhook")
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	watched := []common.Address{database.NewAccount(testKsTanyaAccount)}
+
+	cases := []struct {
+		webhook Webhook
+		isValid bool
+	}{
+		{Webhook{ID: "funds", URL: "https://localhost:9000", Addresses: watched, Direction: EventDirectionIn}, true},
+		{Webhook{URL: "https://localhost:9000"}, false},
+		{Webhook{ID: "tx", URL: "localhost:9000"}, false},
+		{Webhook{ID: "tx", URL: "http://localhost:9000", Events: []string{EventPendingTx}}, false},
+		{Webhook{ID: "funds", URL: "http://localhost:9000", Addresses: watched, Direction: "both"}, false},
+		{Webhook{ID: "funds", URL: "http://localhost:9000", Direction: EventDirectionIn}, false},
+	}
+
+	for _, c := range cases {
+		err := c.webhook.Validate()
+		if (err == nil) != c.isValid {
+			t.Fatalf("webhook %+v validity should be %t, got %v", c.webhook, c.isValid, err)
+		}
+	}
+}
+
+// waitTestWebhookDeliveries waits for the deliveries to be over.
+func TestWebhookDispatcherStopAbandonsRetries(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	d := newWebhookDispatcher([]Webhook{{ID: "down", URL: receiver.URL}}, logger.Discard())
+	d.backoff = time.Hour
+
+	d.publish(Event{Topic: EventNewBlock})
+
+	for i := 0; i < 500 && d.Deliveries("down")[0].Attempts == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		d.stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopping the dispatcher should not wait for the retries backoff")
+	}
+}
+
+func waitTestWebhookDeliveries(t *testing.T, n *Node, webhookID string) []WebhookDelivery {
+	for i := 0; i < 500; i++ {
+		deliveries := n.webhooks.Deliveries(webhookID)
+
+		isOver := len(deliveries) > 0
+		for _, delivery := range deliveries {
+			isOver = isOver && delivery.Status != WebhookDeliveryPending
+		}
+
+		if isOver {
+			return deliveries
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("webhook deliveries didn't complete in time")
+	return nil
+}
@@ -0,0 +1,267 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+const endpointWS = "/ws"
+
+const wsActionSubscribe = "subscribe"
+const wsActionUnsubscribe = "unsubscribe"
+
+const wsSendBufferSize = 256
+const wsWriteTimeout = 10 * time.Second
+const wsPongTimeout = 60 * time.Second
+const wsPingInterval = wsPongTimeout * 9 / 10
+const wsMaxReqSize = 4096
+
+// WsReq subscribes to, or unsubscribes from, a topic. The `balances`
+// topic requires the watched `addresses`.
+type WsReq struct {
+	Action    string           `json:"action"`
+	Topic     string           `json:"topic"`
+	Addresses []common.Address `json:"addresses"`
+}
+
+type WsRes struct {
+	Action string `json:"action,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsHub fans the published Events out to the connected WebSocket clients.
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	logger  log.Logger
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+	send chan interface{}
+
+	mu        sync.Mutex
+	topics    map[string]bool
+	addresses map[common.Address]bool
+}
+
+func newWsHub(logger log.Logger) *wsHub {
+	return &wsHub{clients: make(map[*wsClient]struct{}), logger: logger}
+}
+
+func (h *wsHub) register(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clients[c] = struct{}{}
+}
+
+func (h *wsHub) unregister(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, isRegistered := h.clients[c]; isRegistered {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// reply answers a subscription request unless the client was dropped.
+func (h *wsHub) reply(c *wsClient, res WsRes) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, isRegistered := h.clients[c]; !isRegistered {
+		return
+	}
+
+	select {
+	case c.send <- res:
+	default:
+	}
+}
+
+// closeAll disconnects every client as the node is shutting down.
+func (h *wsHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// publish never blocks the chain, clients too slow to keep up are dropped.
+func (h *wsHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		if !c.isSubscribed(event) {
+			continue
+		}
+
+		select {
+		case c.send <- event:
+		default:
+			h.logger.Warn("Dropping slow WebSocket client", "addr", c.conn.RemoteAddr())
+			delete(h.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+func newWsClient(conn *websocket.Conn) *wsClient {
+	return &wsClient{
+		conn:      conn,
+		send:      make(chan interface{}, wsSendBufferSize),
+		topics:    make(map[string]bool),
+		addresses: make(map[common.Address]bool),
+	}
+}
+
+func (c *wsClient) isSubscribed(event Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.topics[event.Topic] {
+		return false
+	}
+
+	if event.Topic == EventBalance {
+		return event.relatesTo(c.addresses, "")
+	}
+
+	return true
+}
+
+func (c *wsClient) handle(req WsReq) WsRes {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := WsRes{Action: req.Action, Topic: req.Topic}
+
+	switch req.Topic {
+	case EventNewBlock, EventPendingTx:
+	case EventBalance:
+		if req.Action == wsActionSubscribe && len(req.Addresses) == 0 {
+			res.Error = fmt.Sprintf("topic '%s' requires addresses", EventBalance)
+			return res
+		}
+	default:
+		res.Error = fmt.Sprintf("unknown topic '%s'", req.Topic)
+		return res
+	}
+
+	switch req.Action {
+	case wsActionSubscribe:
+		c.topics[req.Topic] = true
+		for _, address := range req.Addresses {
+			c.addresses[address] = true
+		}
+	case wsActionUnsubscribe:
+		if req.Topic == EventBalance && len(req.Addresses) > 0 {
+			for _, address := range req.Addresses {
+				delete(c.addresses, address)
+			}
+			c.topics[req.Topic] = len(c.addresses) > 0
+		} else {
+			delete(c.topics, req.Topic)
+		}
+	default:
+		res.Error = fmt.Sprintf("unknown action '%s'", req.Action)
+	}
+
+	return res
+}
+
+// readLoop processes the client subscriptions until the connection closes.
+func (c *wsClient) readLoop(hub *wsHub) {
+	defer func() {
+		hub.unregister(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(wsMaxReqSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		req := WsReq{}
+		err := c.conn.ReadJSON(&req)
+		if err != nil {
+			if _, isCloseErr := err.(*websocket.CloseError); !isCloseErr {
+				hub.logger.Debug("WebSocket client disconnected", "addr", c.conn.RemoteAddr(), "err", err)
+			}
+			return
+		}
+
+		hub.reply(c, c.handle(req))
+	}
+}
+
+// writeLoop pushes the Events and subscription replies, keeping the
+// connection alive with pings.
+func (c *wsClient) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, isOpen := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !isOpen {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			err := c.conn.WriteJSON(msg)
+			if err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err := c.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func wsHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	upgrader := wsUpgrader
+	upgrader.CheckOrigin = node.checkWsOrigin
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an HTTP error
+		node.httpLogger.Debug("WebSocket upgrade failed", "err", err)
+		return
+	}
+
+	c := newWsClient(conn)
+	node.wsHub.register(c)
+
+	go c.writeLoop()
+	go c.readLoop(node.wsHub)
+}
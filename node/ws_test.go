@@ -0,0 +1,147 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/websocket"
+	"github.com/simone-trubian/blockchain-tutorial/database"
+	"github.com/simone-trubian/blockchain-tutorial/wallet"
+)
+
+func TestWsSubscriptions(t *testing.T) {
+	senderPrivKey, _, sender, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newTestNodeWithState(t, map[common.Address]uint{sender: 1000})
+	conn := dialTestWs(t, n)
+
+	sendTestWsReq(t, conn, WsReq{Action: wsActionSubscribe, Topic: "unknown"})
+	if res := readTestWsRes(t, conn); res.Error == "" {
+		t.Fatal("subscribing to an unknown topic should fail")
+	}
+
+	sendTestWsReq(t, conn, WsReq{Action: wsActionSubscribe, Topic: EventPendingTx})
+	sendTestWsReq(t, conn, WsReq{
+		Action:    wsActionSubscribe,
+		Topic:     EventBalance,
+		Addresses: []common.Address{sender},
+	})
+	for i := 0; i < 2; i++ {
+		if res := readTestWsRes(t, conn); res.Error != "" {
+			t.Fatal(res.Error)
+		}
+	}
+
+	tx, err := wallet.SignTx(
+		database.NewTx(sender, database.NewAccount(testKsTanyaAccount), 10, ""), senderPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.AddPendingTX(tx, n.info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := readTestWsEvent(t, conn)
+	pendingTx := BlockTxRes{}
+	err = json.Unmarshal(event.Data, &pendingTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Topic != EventPendingTx || pendingTx.Hash != txHash {
+		t.Fatalf("expected the pending TX, got %s: %s", event.Topic, event.Data)
+	}
+
+	// Not subscribed to newBlocks, nor to the receiver balance
+	block := database.NewBlock(
+		database.Hash{}, 0, 0, 0, database.NewAccount(DefaultMiner), []database.SignedTx{tx})
+	n.publishBlock(database.BlockFS{Key: database.Hash{1}, Value: block})
+
+	event = readTestWsEvent(t, conn)
+	if event.Topic != EventBalance {
+		t.Fatalf("expected only the sender balance change, got %s", event.Topic)
+	}
+
+	balance := BalanceChangeRes{}
+	err = json.Unmarshal(event.Data, &balance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if balance.Account != sender || balance.BlockHash != (database.Hash{1}) {
+		t.Fatalf("unexpected balance change %+v", balance)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, msg, err := conn.ReadMessage()
+	if err == nil {
+		t.Fatalf("expected no further events, got %s", msg)
+	}
+}
+
+type testWsEvent struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func dialTestWs(t *testing.T, n *Node) *websocket.Conn {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsHandler(w, r, n)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(server.URL, "http")+endpointWS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func sendTestWsReq(t *testing.T, conn *websocket.Conn, req WsReq) {
+	err := conn.WriteJSON(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestWsRes(t *testing.T, conn *websocket.Conn) WsRes {
+	res := WsRes{}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	err := conn.ReadJSON(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func readTestWsEvent(t *testing.T, conn *websocket.Conn) testWsEvent {
+	event := testWsEvent{}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	err := conn.ReadJSON(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
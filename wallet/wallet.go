@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -15,12 +16,47 @@ import (
 )
 
 const keystoreDirName = "keystore"
+const nodeKeyFileName = "nodekey"
 const SimoneAccount = "0x22ba1F80452E6220c7cc6ea2D1e3EEDDaC5F694A"
 
 func GetKeystoreDirPath(dataDir string) string {
 	return filepath.Join(dataDir, keystoreDirName)
 }
 
+func GetNodeKeyFilePath(dataDir string) string {
+	return filepath.Join(dataDir, nodeKeyFileName)
+}
+
+// LoadOrCreateNodeKey loads the private key identifying the node to its
+// peers, generating and storing a new one on the first run.
+func LoadOrCreateNodeKey(dataDir string) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.LoadECDSA(GetNodeKeyFilePath(dataDir))
+	if err == nil {
+		return key, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to load the node key. %s", err.Error())
+	}
+
+	key, err = crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dataDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = crypto.SaveECDSA(GetNodeKeyFilePath(dataDir), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
 func NewKeystoreAccount(dataDir, password string) (common.Address, error) {
 	ks := keystore.NewKeyStore(GetKeystoreDirPath(
 		dataDir), keystore.StandardScryptN, keystore.StandardScryptP)
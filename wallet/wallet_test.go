@@ -129,3 +129,25 @@ func TestSignForgedTxWithKeystoreAccount(t *testing.T) {
 		t.Fatal("the TX 'from' attribute was forged and should have not be authentic")
 	}
 }
+
+func TestLoadOrCreateNodeKey(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wallet_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(tmpDir)
+
+	key, err := LoadOrCreateNodeKey(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loadedKey, err := LoadOrCreateNodeKey(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if crypto.PubkeyToAddress(key.PublicKey) != crypto.PubkeyToAddress(loadedKey.PublicKey) {
+		t.Fatal("node key should be reloaded from the data dir")
+	}
+}